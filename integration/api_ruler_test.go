@@ -3,12 +3,13 @@
 package main
 
 import (
+	"context"
 	"path/filepath"
 	"testing"
+	"time"
 
-	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/common/model"
 	"github.com/stretchr/testify/require"
-	"gopkg.in/yaml.v3"
 
 	"github.com/cortexproject/cortex/integration/e2e"
 	e2edb "github.com/cortexproject/cortex/integration/e2e/db"
@@ -19,19 +20,14 @@ func TestRulerAPI(t *testing.T) {
 	var (
 		namespaceOne = "test_/encoded_+namespace/?"
 		namespaceTwo = "test_/encoded_+namespace/?/two"
-
-		recordNode = yaml.Node{}
-		exprNode   = yaml.Node{}
 	)
-	recordNode.SetString("test_rule")
-	exprNode.SetString("up")
-	ruleGroup := rulefmt.RuleGroup{
+	ruleGroup := e2ecortex.RuleGroup{
 		Name:     "test_encoded_+\"+group_name/?",
 		Interval: 100,
-		Rules: []rulefmt.RuleNode{
+		Rules: []e2ecortex.Rule{
 			{
-				Record: recordNode,
-				Expr:   exprNode,
+				Record: "test_rule",
+				Expr:   "up",
 			},
 		},
 	}
@@ -140,3 +136,131 @@ func TestRulerAPISingleBinary(t *testing.T) {
 	require.NoError(t, cortex.WaitForMetricWithLabels(e2e.EqualsSingle(0), "prometheus_engine_queries", map[string]string{"engine": "querier"}))
 	require.NoError(t, cortex.WaitForMetricWithLabels(e2e.EqualsSingle(0), "prometheus_engine_queries", map[string]string{"engine": "ruler"}))
 }
+
+func TestRulerEvaluationInterval(t *testing.T) {
+	const namespace = "ns"
+
+	ruleGroup := e2ecortex.RuleGroup{
+		Name:     "custom_interval",
+		Interval: model.Duration(5 * time.Second),
+		Limit:    10,
+		Rules: []e2ecortex.Rule{
+			{
+				Record: "test_rule",
+				Expr:   "vector(1)",
+			},
+		},
+	}
+
+	s, err := e2e.NewScenario(networkName)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Start dependencies.
+	dynamo := e2edb.NewDynamoDB()
+	minio := e2edb.NewMinio(9000, RulerConfigs["-ruler.storage.s3.buckets"])
+	require.NoError(t, s.StartAndWaitReady(minio, dynamo))
+
+	// Start Cortex components.
+	require.NoError(t, writeFileToSharedDir(s, cortexSchemaConfigFile, []byte(cortexSchemaConfigYaml)))
+	ruler := e2ecortex.NewRuler("ruler", mergeFlags(ChunksStorageFlags, RulerConfigs), "")
+	require.NoError(t, s.StartAndWaitReady(ruler))
+
+	// Create a client with the ruler address configured
+	c, err := e2ecortex.NewClient("", "", "", ruler.HTTPEndpoint(), "user-1")
+	require.NoError(t, err)
+
+	// The interval should round-trip through the API, while the limit isn't
+	// supported by the ruler yet.
+	require.NoError(t, c.SetRuleGroup(ruleGroup, namespace))
+
+	retrieved, err := c.GetRuleGroup(namespace, ruleGroup.Name)
+	require.NoError(t, err)
+	require.Equal(t, ruleGroup.Interval, retrieved.Interval)
+	require.Equal(t, ruleGroup.Rules, retrieved.Rules)
+
+	// Wait until the rule group is loaded and evaluated.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	_, err = c.WaitForRuleActive(ctx, namespace, ruleGroup.Name, "test_rule", "ok", e2ecortex.WithPollInterval(500*time.Millisecond))
+	require.NoError(t, err)
+
+	// Collect the timestamps of a few consecutive evaluations of the group.
+	var evaluations []time.Time
+	for len(evaluations) < 3 && ctx.Err() == nil {
+		groups, err := c.GetPrometheusRules()
+		require.NoError(t, err)
+
+		for _, g := range groups {
+			if g.File != namespace || g.Name != ruleGroup.Name {
+				continue
+			}
+
+			require.Equal(t, 5.0, g.Interval)
+			if len(evaluations) == 0 || g.LastEvaluation.After(evaluations[len(evaluations)-1]) {
+				evaluations = append(evaluations, g.LastEvaluation)
+			}
+		}
+
+		time.Sleep(500 * time.Millisecond)
+	}
+	require.Len(t, evaluations, 3)
+
+	// The group should be evaluated every 5 seconds.
+	for i := 1; i < len(evaluations); i++ {
+		require.InDelta(t, 5*time.Second, evaluations[i].Sub(evaluations[i-1]), float64(time.Second))
+	}
+}
+
+func TestRulerEvaluationError(t *testing.T) {
+	const namespace = "ns"
+
+	// The query loads two samples at once, which exceeds the max samples of the
+	// ruler configured below, so each evaluation fails.
+	ruleGroup := e2ecortex.RuleGroup{
+		Name:     "failing",
+		Interval: model.Duration(5 * time.Second),
+		Rules: []e2ecortex.Rule{
+			{
+				Record: "test_rule",
+				Expr:   `sum(vector(1) or label_replace(vector(1), "job", "a", "", ""))`,
+			},
+		},
+	}
+
+	s, err := e2e.NewScenario(networkName)
+	require.NoError(t, err)
+	defer s.Close()
+
+	// Start dependencies.
+	dynamo := e2edb.NewDynamoDB()
+	minio := e2edb.NewMinio(9000, RulerConfigs["-ruler.storage.s3.buckets"])
+	require.NoError(t, s.StartAndWaitReady(minio, dynamo))
+
+	// Start Cortex components.
+	require.NoError(t, writeFileToSharedDir(s, cortexSchemaConfigFile, []byte(cortexSchemaConfigYaml)))
+	ruler := e2ecortex.NewRuler("ruler", mergeFlags(ChunksStorageFlags, RulerConfigs, map[string]string{
+		"-querier.max-samples": "1",
+	}), "")
+	require.NoError(t, s.StartAndWaitReady(ruler))
+
+	// Create a client with the ruler address configured
+	c, err := e2ecortex.NewClient("", "", "", ruler.HTTPEndpoint(), "user-1")
+	require.NoError(t, err)
+
+	require.NoError(t, c.SetRuleGroup(ruleGroup, namespace))
+
+	// Wait until the rule group is loaded and its evaluation fails.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rule, err := c.WaitForRuleActive(ctx, namespace, ruleGroup.Name, "test_rule", e2ecortex.RuleHealthErr, e2ecortex.WithPollInterval(500*time.Millisecond))
+	require.NoError(t, err)
+
+	// The error should be the one of the last evaluation, run within one
+	// evaluation interval.
+	require.Contains(t, rule.LastError, "query processing would load too many samples into memory")
+	require.WithinDuration(t, time.Now(), rule.LastEvaluation, time.Duration(ruleGroup.Interval)+time.Second)
+	require.Greater(t, rule.EvaluationTime, 0.0)
+}
@@ -0,0 +1,194 @@
+package e2ecortex
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// emptyResultDiagnosticRange is the time range, before the query time, over
+	// which the diagnostic context of AssertEmptyResult is fetched.
+	emptyResultDiagnosticRange = 5 * time.Minute
+
+	// emptyResultDiagnosticStep is the step of the range query fetching the
+	// recent samples of the unexpected series.
+	emptyResultDiagnosticStep = 15 * time.Second
+
+	// assertEmptyRange is the time range, before now, over which AssertEmpty
+	// looks up the tenant's series.
+	assertEmptyRange = 24 * time.Hour
+)
+
+// TestingT is the subset of testing.TB used by the assertion helpers.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AssertEmptyResult asserts the input instant query returns no data at the
+// input time. On failure, the full label sets of the returned series, fetched
+// through the series API, and their recent samples, fetched through a range
+// query, are included in the failure message. Returns whether the assertion
+// succeeded.
+func AssertEmptyResult(t TestingT, c *Client, query string, ts time.Time) bool {
+	t.Helper()
+
+	value, err := c.Query(query, ts)
+	if err != nil {
+		t.Errorf("query %q failed: %v", query, err)
+		return false
+	}
+
+	var metrics []model.Metric
+	switch v := value.(type) {
+	case model.Vector:
+		for _, s := range v {
+			metrics = append(metrics, s.Metric)
+		}
+	case model.Matrix:
+		for _, s := range v {
+			metrics = append(metrics, s.Metric)
+		}
+	default:
+		t.Errorf("query %q returned a %s, but a vector or matrix was expected", query, valueType(value))
+		return false
+	}
+
+	if len(metrics) == 0 {
+		return true
+	}
+
+	sort.Slice(metrics, func(i, j int) bool { return compareMetrics(metrics[i], metrics[j]) < 0 })
+
+	msg := strings.Builder{}
+	fmt.Fprintf(&msg, "query %q at %s expected to return no data, but returned %d series:\n%s", query, ts.UTC().Format(time.RFC3339), len(metrics), value)
+
+	for _, m := range metrics {
+		fmt.Fprintf(&msg, "\n\nseries %s:", m)
+		msg.WriteString(c.emptyResultDiagnostic(m, ts))
+	}
+
+	t.Errorf("%s", msg.String())
+	return false
+}
+
+// emptyResultDiagnostic returns the label sets and the recent samples of the
+// series matching the input metric, as a human readable string.
+func (c *Client) emptyResultDiagnostic(m model.Metric, ts time.Time) string {
+	// The query result may have dropped labels (e.g. the metric name), so the
+	// matching series are looked up to get their full label sets.
+	selector := NewSelector("")
+	for _, l := range metricToLabels(m) {
+		selector.Eq(l.Name, l.Value)
+	}
+	if len(m) == 0 || selector.Err() != nil {
+		return "\n  no diagnostic available"
+	}
+
+	out := strings.Builder{}
+	start := ts.Add(-emptyResultDiagnosticRange)
+
+	series, err := c.Series([]string{selector.String()}, start, ts)
+	if err != nil {
+		fmt.Fprintf(&out, "\n  fetching series failed: %v", err)
+	}
+	for _, s := range series {
+		fmt.Fprintf(&out, "\n  labels: %s", s)
+	}
+
+	samples, err := c.QueryRange(selector.String(), start, ts, emptyResultDiagnosticStep)
+	if err != nil {
+		fmt.Fprintf(&out, "\n  fetching recent samples failed: %v", err)
+	} else {
+		fmt.Fprintf(&out, "\n  recent samples:\n%s", samples)
+	}
+
+	return out.String()
+}
+
+// AssertEmpty returns an error if the tenant has any series within the last
+// 24 hours, listing their labels. This is useful to assert no data leaks across
+// tenants.
+func (c *Client) AssertEmpty() error {
+	end := time.Now()
+
+	series, err := c.Series([]string{`{__name__=~".+"}`}, end.Add(-assertEmptyRange), end)
+	if err != nil {
+		return err
+	}
+
+	if len(series) == 0 {
+		return nil
+	}
+
+	found := make([]string, 0, len(series))
+	for _, s := range series {
+		found = append(found, s.String())
+	}
+	sort.Strings(found)
+
+	return fmt.Errorf("expected no series for the tenant, but found %d:\n%s", len(series), strings.Join(found, "\n"))
+}
+
+// QueryAndExpectVector runs the input instant query at the input time, and
+// returns an error if the result isn't a vector with the expected samples,
+// regardless of their ordering. The error lists all the missing, unexpected and
+// different series.
+func (c *Client) QueryAndExpectVector(query string, ts time.Time, expected model.Vector) error {
+	value, err := c.Query(query, ts)
+	if err != nil {
+		return fmt.Errorf("query %q failed: %w", query, err)
+	}
+
+	actual, ok := value.(model.Vector)
+	if !ok {
+		return fmt.Errorf("query %q returned a %s, but a vector was expected", query, valueType(value))
+	}
+
+	if diff := diffVectors(expected, actual); len(diff) > 0 {
+		return fmt.Errorf("query %q at %s returned an unexpected vector:\n%s", query, ts.UTC().Format(time.RFC3339), strings.Join(diff, "\n"))
+	}
+	return nil
+}
+
+// diffVectors returns the differences between the input vectors, sorted by
+// series. Sample values are compared exactly, NaN values being equal.
+func diffVectors(expected, actual model.Vector) []string {
+	actualByFingerprint := make(map[model.Fingerprint]*model.Sample, len(actual))
+	for _, s := range actual {
+		actualByFingerprint[s.Metric.Fingerprint()] = s
+	}
+
+	expected = append(model.Vector(nil), expected...)
+	sort.Slice(expected, func(i, j int) bool { return compareMetrics(expected[i].Metric, expected[j].Metric) < 0 })
+
+	var diff []string
+	for _, e := range expected {
+		a, ok := actualByFingerprint[e.Metric.Fingerprint()]
+		if !ok {
+			diff = append(diff, fmt.Sprintf("- %s", e))
+			continue
+		}
+		delete(actualByFingerprint, e.Metric.Fingerprint())
+
+		if _, err := compareSampleValues(e.Value, a.Value, 0); err != nil || e.Timestamp != a.Timestamp {
+			diff = append(diff, fmt.Sprintf("~ %s: expected %s @[%v], got %s @[%v]", e.Metric, e.Value, e.Timestamp, a.Value, a.Timestamp))
+		}
+	}
+
+	unexpected := make(model.Vector, 0, len(actualByFingerprint))
+	for _, s := range actualByFingerprint {
+		unexpected = append(unexpected, s)
+	}
+	sort.Slice(unexpected, func(i, j int) bool { return compareMetrics(unexpected[i].Metric, unexpected[j].Metric) < 0 })
+
+	for _, s := range unexpected {
+		diff = append(diff, fmt.Sprintf("+ %s", s))
+	}
+
+	return diff
+}
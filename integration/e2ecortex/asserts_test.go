@@ -0,0 +1,128 @@
+package e2ecortex
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockTestingT struct {
+	errors []string
+}
+
+func (m *mockTestingT) Helper() {}
+
+func (m *mockTestingT) Errorf(format string, args ...interface{}) {
+	m.errors = append(m.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertEmptyResult(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/prom/api/v1/query":
+			if r.Form.Get("query") == "sum(deleted_series)" {
+				_, _ = w.Write([]byte(emptyVectorResponse))
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"job":"leaked"},"value":[1000,"1"]}]}}`))
+		case "/api/prom/api/v1/series":
+			assert.Equal(t, []string{`{job="leaked"}`}, r.Form["match[]"])
+			_, _ = w.Write([]byte(`{"status":"success","data":[{"__name__":"series_1","job":"leaked","tenant":"user-2"}]}`))
+		case "/api/prom/api/v1/query_range":
+			assert.Equal(t, `{job="leaked"}`, r.Form.Get("query"))
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"series_1","job":"leaked","tenant":"user-2"},"values":[[985,"1"],[1000,"1"]]}]}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	ts := time.Unix(1000, 0)
+
+	mock := &mockTestingT{}
+	assert.True(t, AssertEmptyResult(mock, c, "sum(deleted_series)", ts))
+	assert.Empty(t, mock.errors)
+
+	assert.False(t, AssertEmptyResult(mock, c, "max by (job) (series_1)", ts))
+	require.Len(t, mock.errors, 1)
+	assert.Contains(t, mock.errors[0], `expected to return no data, but returned 1 series`)
+	assert.Contains(t, mock.errors[0], `labels: {__name__="series_1", job="leaked", tenant="user-2"}`)
+	assert.Contains(t, mock.errors[0], "recent samples:")
+	assert.Contains(t, mock.errors[0], "1 @[985]")
+}
+
+func TestClient_AssertEmpty(t *testing.T) {
+	response := `{"status":"success","data":[]}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "/api/prom/api/v1/series", r.URL.Path)
+		assert.Equal(t, []string{`{__name__=~".+"}`}, r.Form["match[]"])
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	require.NoError(t, c.AssertEmpty())
+
+	response = `{"status":"success","data":[{"__name__":"series_2","job":"leaked"},{"__name__":"series_1","tenant":"user-2"}]}`
+	err := c.AssertEmpty()
+	require.Error(t, err)
+	assert.Equal(t, "expected no series for the tenant, but found 2:\n"+
+		`{__name__="series_1", tenant="user-2"}`+"\n"+
+		`{__name__="series_2", job="leaked"}`, err.Error())
+}
+
+func TestClient_QueryAndExpectVector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.Form.Get("query") {
+		case "series":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[
+				{"metric":{"job":"b"},"value":[1000,"2"]},
+				{"metric":{"job":"a"},"value":[1000,"1"]},
+				{"metric":{"job":"c"},"value":[1000,"NaN"]}
+			]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"scalar","result":[1000,"1"]}}`))
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	ts := time.Unix(1000, 0)
+
+	sample := func(job string, value float64) *model.Sample {
+		return &model.Sample{Metric: model.Metric{"job": model.LabelValue(job)}, Value: model.SampleValue(value), Timestamp: 1000000}
+	}
+
+	// The ordering of the series should be ignored.
+	require.NoError(t, c.QueryAndExpectVector("series", ts, model.Vector{sample("c", math.NaN()), sample("a", 1), sample("b", 2)}))
+
+	err := c.QueryAndExpectVector("series", ts, model.Vector{sample("d", 4), sample("b", 3), sample("a", 1)})
+	require.Error(t, err)
+	assert.Equal(t, `query "series" at 1970-01-01T00:16:40Z returned an unexpected vector:
+~ {job="b"}: expected 3 @[1000], got 2 @[1000]
+- {job="d"} => 4 @[1000]
++ {job="c"} => NaN @[1000]`, err.Error())
+
+	err = c.QueryAndExpectVector("scalar(series)", ts, model.Vector{sample("a", 1)})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "returned a scalar, but a vector was expected")
+}
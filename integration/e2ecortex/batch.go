@@ -0,0 +1,84 @@
+package e2ecortex
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+// QuerySpec is a query executed by QueryBatch. It's run as a range query if
+// Step is set, otherwise as an instant query evaluated at Time.
+type QuerySpec struct {
+	Query string
+
+	// Time is the evaluation time of an instant query.
+	Time time.Time
+
+	// Start, End and Step are the time range of a range query.
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+
+	Options []QueryOption
+}
+
+// QueryResult is the result of a query executed by QueryBatch.
+type QueryResult struct {
+	Value model.Value
+	Err   error
+}
+
+// QueryBatch executes the input queries using a pool of concurrency workers,
+// sharing the client transport, and returns their results in the same order as
+// the input queries. A failing query doesn't abort the batch: its error is
+// stored in its result. Once the context is done, the in-flight queries are
+// canceled and the queries not executed yet fail with the context error.
+func (c *Client) QueryBatch(ctx context.Context, queries []QuerySpec, concurrency int) []QueryResult {
+	results := make([]QueryResult, len(queries))
+
+	if concurrency <= 0 {
+		for i := range results {
+			results[i].Err = fmt.Errorf("invalid concurrency %d", concurrency)
+		}
+		return results
+	}
+
+	var (
+		wg = sync.WaitGroup{}
+		ch = make(chan int)
+	)
+
+	for ix := 0; ix < concurrency; ix++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range ch {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+
+				results[i].Value, results[i].Err = c.runQuerySpec(ctx, queries[i])
+			}
+		}()
+	}
+
+	for i := range queries {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+
+	return results
+}
+
+func (c *Client) runQuerySpec(ctx context.Context, spec QuerySpec) (model.Value, error) {
+	if spec.Step > 0 {
+		return c.queryRange(ctx, spec.Query, spec.Start, spec.End, spec.Step, spec.Options)
+	}
+	return c.query(ctx, spec.Query, spec.Time, spec.Options)
+}
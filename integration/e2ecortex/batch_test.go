@@ -0,0 +1,146 @@
+package e2ecortex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeQuerier returns a server replying to instant and range queries with a
+// scalar whose value is the query itself, after the input delay. Queries named
+// "fail" are rejected.
+func newFakeQuerier(delay time.Duration) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		query := r.Form.Get("query")
+		if query == "fail" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+			return
+		}
+
+		if r.URL.Path == "/api/prom/api/v1/query_range" {
+			_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1,"%s"]]}]}}`, query)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"scalar","result":[1,"%s"]}}`, query)
+	}))
+}
+
+func TestClient_QueryBatch(t *testing.T) {
+	server := newFakeQuerier(0)
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+
+	queries := []QuerySpec{
+		{Query: "1", Time: now},
+		{Query: "fail", Time: now},
+		{Query: "3", Start: now.Add(-time.Minute), End: now, Step: 15 * time.Second},
+	}
+	for i := 4; i <= 20; i++ {
+		queries = append(queries, QuerySpec{Query: fmt.Sprint(i), Time: now})
+	}
+
+	results := c.QueryBatch(context.Background(), queries, 4)
+	require.Len(t, results, len(queries))
+
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, model.SampleValue(1), results[0].Value.(*model.Scalar).Value)
+
+	var apiErr *APIError
+	require.True(t, errors.As(results[1].Err, &apiErr))
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+
+	require.NoError(t, results[2].Err)
+	require.Equal(t, model.ValMatrix, results[2].Value.Type())
+	assert.Equal(t, model.SampleValue(3), results[2].Value.(model.Matrix)[0].Values[0].Value)
+
+	// Results should be in the same order as the input queries.
+	for i := 3; i < len(queries); i++ {
+		require.NoError(t, results[i].Err)
+		assert.Equal(t, model.SampleValue(i+1), results[i].Value.(*model.Scalar).Value)
+	}
+
+	// Queries should not be executed once the context is canceled.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, res := range c.QueryBatch(ctx, queries, 4) {
+		assert.Equal(t, context.Canceled, res.Err)
+	}
+
+	for _, res := range c.QueryBatch(context.Background(), queries, 0) {
+		assert.Error(t, res.Err)
+	}
+}
+
+func TestClient_QueryBatch_CancelInFlight(t *testing.T) {
+	// The queries never complete, until they're canceled.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request context is only canceled once the body has been read.
+		_ = r.ParseForm()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+
+	queries := []QuerySpec{
+		{Query: "1", Time: now},
+		{Query: "2", Start: now.Add(-time.Minute), End: now, Step: 15 * time.Second},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	for _, res := range c.QueryBatch(ctx, queries, 2) {
+		assert.Error(t, res.Err)
+	}
+	assert.Less(t, int64(time.Since(start)), int64(c.timeout))
+}
+
+func BenchmarkClient_QueryBatch(b *testing.B) {
+	server := newFakeQuerier(5 * time.Millisecond)
+	defer server.Close()
+
+	addr := strings.TrimPrefix(server.URL, "http://")
+	c, err := NewClient(addr, addr, addr, addr, "user-1")
+	require.NoError(b, err)
+
+	queries := make([]QuerySpec, 50)
+	for i := range queries {
+		queries[i] = QuerySpec{Query: fmt.Sprint(i), Time: time.Now()}
+	}
+
+	for _, concurrency := range []int{1, 10} {
+		b.Run(fmt.Sprintf("concurrency=%d", concurrency), func(b *testing.B) {
+			for n := 0; n < b.N; n++ {
+				for _, res := range c.QueryBatch(context.Background(), queries, concurrency) {
+					if res.Err != nil {
+						b.Fatal(res.Err)
+					}
+				}
+			}
+		})
+	}
+}
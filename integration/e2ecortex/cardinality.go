@@ -0,0 +1,154 @@
+package e2ecortex
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// UserStats contains the ingestion statistics of a tenant, as returned by the
+// user stats API.
+type UserStats struct {
+	IngestionRate     float64 `json:"ingestionRate"`
+	NumSeries         uint64  `json:"numSeries"`
+	APIIngestionRate  float64 `json:"APIIngestionRate"`
+	RuleIngestionRate float64 `json:"RuleIngestionRate"`
+}
+
+// GetUserStats returns the ingestion statistics of the tenant, aggregated by
+// the querier across ingesters. Returns ErrNotFound if the endpoint doesn't exist.
+func (c *Client) GetUserStats() (UserStats, error) {
+	stats := UserStats{}
+
+	res, body, err := c.doRequest(http.MethodGet, fmt.Sprintf("http://%s/api/v1/user_stats", c.querierAddress), nil, nil)
+	if err != nil {
+		return stats, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return stats, ErrNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return stats, fmt.Errorf("getting user stats failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	err = json.Unmarshal(body, &stats)
+	return stats, err
+}
+
+// CardinalitySnapshot is the cardinality of a tenant at a point in time. Stats
+// are sorted by value in descending order, and then by name, so that two
+// snapshots can be diffed.
+type CardinalitySnapshot struct {
+	// NumSeries is the number of in-memory series in the ingesters, or 0 if the
+	// user stats are not available.
+	NumSeries uint64
+
+	// SeriesCountByMetricName are the top metric names by number of series.
+	SeriesCountByMetricName []TSDBStat
+
+	// LabelValueCountByLabelName are the top label names by number of values.
+	LabelValueCountByLabelName []TSDBStat
+
+	// Sources are the APIs the snapshot has been built from.
+	Sources []string
+}
+
+// cardinalityFallbackRange is the time range queried to build the cardinality
+// snapshot through the labels and series APIs, when the TSDB status is not available.
+const cardinalityFallbackRange = time.Hour
+
+// CardinalitySnapshot returns the cardinality of the tenant, keeping the topN
+// stats only. It's built from the user stats and TSDB status APIs when they're
+// available, otherwise it degrades to the labels and series APIs, looking at
+// the series of the last hour. The context is checked between requests.
+func (c *Client) CardinalitySnapshot(ctx context.Context, topN int) (CardinalitySnapshot, error) {
+	snapshot := CardinalitySnapshot{}
+
+	stats, err := c.GetUserStats()
+	if err == nil {
+		snapshot.NumSeries = stats.NumSeries
+		snapshot.Sources = append(snapshot.Sources, "user_stats")
+	} else if err != ErrNotFound {
+		return snapshot, err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return snapshot, err
+	}
+
+	status, err := c.TSDBStatus()
+	switch {
+	case err == nil:
+		snapshot.SeriesCountByMetricName = topStats(status.SeriesCountByMetricName, topN)
+		snapshot.LabelValueCountByLabelName = topStats(status.LabelValueCountByLabelName, topN)
+		snapshot.Sources = append(snapshot.Sources, "tsdb_status")
+		return snapshot, nil
+	case err != ErrNotFound:
+		return snapshot, err
+	}
+
+	// Fallback to the labels and series APIs.
+	names, err := c.LabelNames()
+	if err != nil {
+		return snapshot, err
+	}
+
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return snapshot, err
+		}
+
+		values, err := c.LabelValues(name)
+		if err != nil {
+			return snapshot, err
+		}
+		snapshot.LabelValueCountByLabelName = append(snapshot.LabelValueCountByLabelName, TSDBStat{Name: name, Value: uint64(len(values))})
+
+		if name != "__name__" {
+			continue
+		}
+
+		end := time.Now()
+		for _, metric := range values {
+			if err := ctx.Err(); err != nil {
+				return snapshot, err
+			}
+
+			count, err := c.SeriesCount([]string{NewSelector("").Eq("__name__", string(metric)).String()}, end.Add(-cardinalityFallbackRange), end)
+			if err != nil {
+				return snapshot, err
+			}
+			snapshot.SeriesCountByMetricName = append(snapshot.SeriesCountByMetricName, TSDBStat{Name: string(metric), Value: uint64(count)})
+		}
+	}
+
+	snapshot.SeriesCountByMetricName = topStats(snapshot.SeriesCountByMetricName, topN)
+	snapshot.LabelValueCountByLabelName = topStats(snapshot.LabelValueCountByLabelName, topN)
+	snapshot.Sources = append(snapshot.Sources, "labels_api", "series_api")
+
+	return snapshot, nil
+}
+
+// topStats returns the topN input stats, sorted by value in descending order
+// and then by name.
+func topStats(stats []TSDBStat, topN int) []TSDBStat {
+	sorted := make([]TSDBStat, len(stats))
+	copy(sorted, stats)
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Value != sorted[j].Value {
+			return sorted[i].Value > sorted[j].Value
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	if topN > 0 && len(sorted) > topN {
+		sorted = sorted[:topN]
+	}
+	return sorted
+}
@@ -0,0 +1,75 @@
+package e2ecortex
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_CardinalitySnapshot(t *testing.T) {
+	tsdbStatusEnabled := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/v1/user_stats":
+			_, _ = w.Write([]byte(`{"ingestionRate":1.5,"numSeries":4,"APIIngestionRate":1.5,"RuleIngestionRate":0}`))
+		case "/api/prom/api/v1/status/tsdb":
+			if !tsdbStatusEnabled {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":{
+				"seriesCountByMetricName":[{"name":"series_2","value":1},{"name":"series_1","value":3}],
+				"labelValueCountByLabelName":[{"name":"pod","value":3},{"name":"__name__","value":2}]
+			}}`))
+		case "/api/prom/api/v1/labels":
+			_, _ = w.Write([]byte(`{"status":"success","data":["__name__","pod"]}`))
+		case "/api/prom/api/v1/label/__name__/values":
+			_, _ = w.Write([]byte(`{"status":"success","data":["series_1","series_2"]}`))
+		case "/api/prom/api/v1/label/pod/values":
+			_, _ = w.Write([]byte(`{"status":"success","data":["a","b","c"]}`))
+		case "/api/prom/api/v1/series":
+			require.NoError(t, r.ParseForm())
+			if r.Form.Get("match[]") == `{__name__="series_1"}` {
+				_, _ = w.Write([]byte(`{"status":"success","data":[{"__name__":"series_1","pod":"a"},{"__name__":"series_1","pod":"b"},{"__name__":"series_1","pod":"c"}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"status":"success","data":[{"__name__":"series_2"}]}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	expected := CardinalitySnapshot{
+		NumSeries:                  4,
+		SeriesCountByMetricName:    []TSDBStat{{Name: "series_1", Value: 3}},
+		LabelValueCountByLabelName: []TSDBStat{{Name: "pod", Value: 3}},
+		Sources:                    []string{"user_stats", "tsdb_status"},
+	}
+
+	snapshot, err := c.CardinalitySnapshot(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, expected, snapshot)
+
+	// The same snapshot should be built without the TSDB status.
+	tsdbStatusEnabled = false
+	expected.Sources = []string{"user_stats", "labels_api", "series_api"}
+
+	snapshot, err = c.CardinalitySnapshot(context.Background(), 1)
+	require.NoError(t, err)
+	assert.Equal(t, expected, snapshot)
+
+	snapshot, err = c.CardinalitySnapshot(context.Background(), 0)
+	require.NoError(t, err)
+	assert.Equal(t, []TSDBStat{{Name: "series_1", Value: 3}, {Name: "series_2", Value: 1}}, snapshot.SeriesCountByMetricName)
+	assert.Equal(t, []TSDBStat{{Name: "pod", Value: 3}, {Name: "__name__", Value: 2}}, snapshot.LabelValueCountByLabelName)
+}
@@ -2,40 +2,181 @@ package e2ecortex
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
 	"time"
 
 	"github.com/gogo/protobuf/proto"
 	"github.com/golang/snappy"
+	"github.com/prometheus/alertmanager/api/v2/models"
 	alertConfig "github.com/prometheus/alertmanager/config"
+	alertTemplate "github.com/prometheus/alertmanager/template"
 	promapi "github.com/prometheus/client_golang/api"
 	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 	"github.com/prometheus/common/model"
-	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/common/version"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/timestamp"
 	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql/parser"
 	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/cortexproject/cortex/pkg/ring"
+	"github.com/cortexproject/cortex/pkg/ruler"
+	"github.com/cortexproject/cortex/pkg/util"
+)
+
+const (
+	// ContentTypeJSON is the content type of JSON encoded query responses.
+	ContentTypeJSON = "application/json"
+
+	// ContentTypeProtobuf is the content type of protobuf encoded query responses.
+	ContentTypeProtobuf = "application/x-protobuf"
 )
 
 var (
 	ErrNotFound = errors.New("not found")
+
+	// ErrRulesFilterNotSupported is returned when the ruler doesn't honour the
+	// filters of GetPrometheusRulesFiltered.
+	ErrRulesFilterNotSupported = errors.New("rules filter not supported by the ruler")
+)
+
+// tenantIDsSeparator is the separator used to query multiple tenants at once
+// when tenant federation is enabled.
+const tenantIDsSeparator = "|"
+
+// DefaultAPIPrefix is the default prefix of the Prometheus-compatible API paths,
+// matching the default Cortex -http.prefix.
+const DefaultAPIPrefix = "/api/prom"
+
+// DefaultHAClusterLabel and DefaultHAReplicaLabel are the labels identifying
+// the cluster and the replica of the series pushed by PushHA, matching the
+// Cortex -distributor.ha-tracker.cluster and -distributor.ha-tracker.replica
+// defaults.
+const (
+	DefaultHAClusterLabel = "cluster"
+	DefaultHAReplicaLabel = "__replica__"
 )
 
+// DefaultUserAgent is the User-Agent header sent by default by the client.
+var DefaultUserAgent = "cortex-e2e/" + defaultVersion(version.Version)
+
+func defaultVersion(v string) string {
+	if v == "" {
+		return "dev"
+	}
+	return v
+}
+
 // Client is a client used to interact with Cortex in integration tests
 type Client struct {
-	alertmanagerClient promapi.Client
-	querierAddress     string
-	rulerAddress       string
-	distributorAddress string
-	timeout            time.Duration
-	httpClient         *http.Client
-	querierClient      promv1.API
-	orgID              string
+	alertmanagerClient  promapi.Client
+	alertmanagerAddress string
+	querierAddress      string
+	rulerAddress        string
+	distributorAddress  string
+	timeout             time.Duration
+	httpClient          *http.Client
+	querierClient       promv1.API
+	orgID               string
+
+	// apiPrefix is the prefix of the Prometheus-compatible API paths.
+	apiPrefix string
+
+	// haClusterLabel and haReplicaLabel are the labels injected by PushHA.
+	haClusterLabel string
+	haReplicaLabel string
+
+	// transport is shared by all the HTTP requests issued by the client.
+	transport http.RoundTripper
+	userAgent string
+
+	// disableRedirects returns 3xx responses as is, instead of following them.
+	disableRedirects bool
+
+	// disableOrgIDHeader skips the X-Scope-OrgID header in all requests.
+	disableOrgIDHeader bool
+
+	// readRetries configures the retries of the read path. Retries are disabled if nil.
+	readRetries *util.BackoffConfig
+}
+
+// ClientOption configures optional settings of a Client.
+type ClientOption func(*Client)
+
+// WithTransport sets the transport used by all the HTTP requests issued by the
+// client, including the ones issued through the Prometheus API clients. It
+// allows to tune connection pooling (e.g. MaxIdleConnsPerHost) in tests
+// generating high throughput. Defaults to http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(c *Client) {
+		c.transport = transport
+	}
+}
+
+// WithReadRetries enables retries on the read path (Query, QueryRange, LabelValues,
+// LabelNames and Series). Requests are retried with exponential backoff on
+// connection errors and 5xx responses, but never on 4xx. The MaxRetries is the
+// max number of attempts, and the overall time spent retrying is capped by the
+// client timeout. Retries are disabled by default.
+func WithReadRetries(cfg util.BackoffConfig) ClientOption {
+	return func(c *Client) {
+		c.readRetries = &cfg
+	}
+}
+
+// WithAPIPrefix sets the prefix of the Prometheus-compatible API paths (push,
+// query, rules and status endpoints), for Cortex configured with a custom
+// -http.prefix. Defaults to DefaultAPIPrefix.
+func WithAPIPrefix(prefix string) ClientOption {
+	return func(c *Client) {
+		c.apiPrefix = strings.TrimSuffix(prefix, "/")
+	}
+}
+
+// WithHALabels sets the labels identifying the cluster and the replica of the
+// series pushed by PushHA, for Cortex configured with custom HA tracker labels.
+// Defaults to DefaultHAClusterLabel and DefaultHAReplicaLabel.
+func WithHALabels(clusterLabel, replicaLabel string) ClientOption {
+	return func(c *Client) {
+		c.haClusterLabel = clusterLabel
+		c.haReplicaLabel = replicaLabel
+	}
+}
+
+// WithoutRedirects disables following redirects in the requests issued by the
+// client, so that 3xx responses (e.g. from the ring pages and other admin
+// endpoints) are returned as is. It doesn't apply to the requests issued through
+// the Prometheus API clients.
+func WithoutRedirects() ClientOption {
+	return func(c *Client) {
+		c.disableRedirects = true
+	}
+}
+
+// NoOrgID disables the X-Scope-OrgID header in all the requests issued by the
+// client, to test Cortex running with auth disabled (single tenant mode).
+func NoOrgID() ClientOption {
+	return func(c *Client) {
+		c.disableOrgIDHeader = true
+	}
 }
 
 // NewClient makes a new Cortex client
@@ -45,305 +186,2500 @@ func NewClient(
 	alertmanagerAddress string,
 	rulerAddress string,
 	orgID string,
+	opts ...ClientOption,
 ) (*Client, error) {
+	c := &Client{
+		distributorAddress:  distributorAddress,
+		querierAddress:      querierAddress,
+		alertmanagerAddress: alertmanagerAddress,
+		rulerAddress:        rulerAddress,
+		timeout:             5 * time.Second,
+		orgID:               orgID,
+		apiPrefix:           DefaultAPIPrefix,
+		haClusterLabel:      DefaultHAClusterLabel,
+		haReplicaLabel:      DefaultHAReplicaLabel,
+		transport:           http.DefaultTransport,
+		userAgent:           DefaultUserAgent,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if err := c.initClients(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// initClients creates the HTTP client used for raw requests and the querier
+// and alertmanager API clients, injecting the client's org ID in each request.
+func (c *Client) initClients() error {
+	transport := &userAgentRoundTripper{client: c, next: c.transport}
+	c.httpClient = &http.Client{Transport: transport}
+	if c.disableRedirects {
+		c.httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		}
+	}
+
 	// Create querier API client
 	querierAPIClient, err := promapi.NewClient(promapi.Config{
-		Address:      "http://" + querierAddress + "/api/prom",
-		RoundTripper: &addOrgIDRoundTripper{orgID: orgID, next: http.DefaultTransport},
+		Address:      "http://" + c.querierAddress + c.apiPrefix,
+		RoundTripper: &addOrgIDRoundTripper{orgID: c.orgID, disabled: c.disableOrgIDHeader, next: transport},
 	})
 	if err != nil {
-		return nil, err
-	}
-
-	c := &Client{
-		distributorAddress: distributorAddress,
-		querierAddress:     querierAddress,
-		rulerAddress:       rulerAddress,
-		timeout:            5 * time.Second,
-		httpClient:         &http.Client{},
-		querierClient:      promv1.NewAPI(querierAPIClient),
-		orgID:              orgID,
+		return err
 	}
+	c.querierClient = promv1.NewAPI(querierAPIClient)
 
-	if alertmanagerAddress != "" {
+	if c.alertmanagerAddress != "" {
 		alertmanagerAPIClient, err := promapi.NewClient(promapi.Config{
-			Address:      "http://" + alertmanagerAddress,
-			RoundTripper: &addOrgIDRoundTripper{orgID: orgID, next: http.DefaultTransport},
+			Address:      "http://" + c.alertmanagerAddress,
+			RoundTripper: &addOrgIDRoundTripper{orgID: c.orgID, disabled: c.disableOrgIDHeader, next: transport},
 		})
 		if err != nil {
-			return nil, err
+			return err
 		}
 		c.alertmanagerClient = alertmanagerAPIClient
 	}
 
-	return c, nil
+	return nil
+}
+
+// PrometheusAPI returns the Prometheus API client used to query the querier,
+// to call API methods not wrapped by this client. It shares the client's round
+// tripper, so the org ID and User-Agent are injected in every request, but the
+// per-query options and the read retries are not applied.
+func (c *Client) PrometheusAPI() promv1.API {
+	return c.querierClient
+}
+
+// SetUserAgent sets the User-Agent header sent with all the requests issued by
+// the client, so that the e2e traffic can be identified in the server logs.
+// Defaults to DefaultUserAgent.
+func (c *Client) SetUserAgent(userAgent string) {
+	c.userAgent = userAgent
+}
+
+// WithOrgIDs returns a copy of the client sending requests on behalf of all the
+// input tenants. When more than one org ID is given, read requests query the
+// tenants at once (tenant federation) while pushes are rejected, because a
+// series can only be written to a single tenant.
+func (c *Client) WithOrgIDs(orgIDs ...string) (*Client, error) {
+	// TODO: Cortex doesn't support tenant federation yet, so the querier reads
+	// the joined org IDs as a single tenant and returns no data. Add an
+	// integration test against a real querier once it does.
+	if len(orgIDs) == 0 {
+		return nil, errors.New("at least one org ID is required")
+	}
+
+	for _, orgID := range orgIDs {
+		if orgID == "" || strings.Contains(orgID, tenantIDsSeparator) {
+			return nil, fmt.Errorf("invalid org ID %q", orgID)
+		}
+	}
+
+	clone := *c
+	clone.orgID = strings.Join(orgIDs, tenantIDsSeparator)
+	clone.disableOrgIDHeader = false
+
+	if err := clone.initClients(); err != nil {
+		return nil, err
+	}
+
+	return &clone, nil
 }
 
 // Push the input timeseries to the remote endpoint
 func (c *Client) Push(timeseries []prompb.TimeSeries) (*http.Response, error) {
+	return c.push(context.Background(), timeseries)
+}
+
+// push sends the input timeseries like Push, canceling the request once ctx
+// is done.
+func (c *Client) push(ctx context.Context, timeseries []prompb.TimeSeries) (*http.Response, error) {
 	// Create write request
 	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: timeseries})
 	if err != nil {
 		return nil, err
 	}
 
-	// Create HTTP request
 	compressed := snappy.Encode(nil, data)
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/api/prom/push", c.distributorAddress), bytes.NewReader(compressed))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Add("Content-Encoding", "snappy")
-	req.Header.Set("Content-Type", "application/x-protobuf")
-	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
-	req.Header.Set("X-Scope-OrgID", c.orgID)
-
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
+	res, _, err := c.pushRaw(ctx, compressed, "snappy", "application/x-protobuf")
+	return res, err
+}
 
-	// Execute HTTP request
-	res, err := c.httpClient.Do(req.WithContext(ctx))
+// PushUncompressed pushes the input timeseries like Push, but sends the
+// protobuf WriteRequest without snappy compression and without the
+// Content-Encoding header, to exercise the distributor's handling of
+// uncompressed requests.
+func (c *Client) PushUncompressed(timeseries []prompb.TimeSeries) (*http.Response, error) {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: timeseries})
 	if err != nil {
 		return nil, err
 	}
 
-	defer res.Body.Close()
-	return res, nil
+	return c.PushRaw(data, "", "application/x-protobuf")
 }
 
-// Query runs a query
-func (c *Client) Query(query string, ts time.Time) (model.Value, error) {
-	value, _, err := c.querierClient.Query(context.Background(), query, ts)
-	return value, err
-}
+// PushHA pushes the input timeseries like Push, as sent by the input replica of
+// an HA Prometheus cluster, to exercise the distributor HA deduplication. The
+// cluster and replica labels are added to each series, replacing any existing
+// value. The input timeseries are not modified.
+func (c *Client) PushHA(cluster, replica string, timeseries []prompb.TimeSeries) (*http.Response, error) {
+	ha := make([]prompb.TimeSeries, 0, len(timeseries))
+	for _, ts := range timeseries {
+		lbls := make([]prompb.Label, 0, len(ts.Labels)+2)
+		for _, l := range ts.Labels {
+			if l.Name != c.haClusterLabel && l.Name != c.haReplicaLabel {
+				lbls = append(lbls, l)
+			}
+		}
+		lbls = append(lbls, prompb.Label{Name: c.haClusterLabel, Value: cluster}, prompb.Label{Name: c.haReplicaLabel, Value: replica})
 
-func (c *Client) QueryRaw(query string) (*http.Response, []byte, error) {
-	addr := fmt.Sprintf("http://%s/api/prom/api/v1/query?query=%s", c.querierAddress, url.QueryEscape(query))
+		ts.Labels = lbls
+		ha = append(ha, ts)
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
+	return c.Push(ha)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", addr, nil)
+// PushExpectRateLimited pushes the input timeseries like Push, and returns
+// whether the push was rate limited (429) or accepted (2xx). Any other response
+// status is returned as an error. The delay suggested by a rate limited
+// response can be read with RetryAfter, pushing through Push instead.
+func (c *Client) PushExpectRateLimited(timeseries []prompb.TimeSeries) (bool, error) {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: timeseries})
 	if err != nil {
-		return nil, nil, err
+		return false, err
 	}
 
-	req.Header.Set("X-Scope-OrgID", c.orgID)
-
-	res, err := c.httpClient.Do(req)
+	res, body, err := c.pushRaw(context.Background(), snappy.Encode(nil, data), "snappy", "application/x-protobuf")
 	if err != nil {
-		return nil, nil, err
+		return false, err
 	}
-	defer res.Body.Close()
 
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, nil, err
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests:
+		return true, nil
+	case res.StatusCode/100 == 2:
+		return false, nil
+	default:
+		return false, fmt.Errorf("pushing series failed with status %d and error %v", res.StatusCode, string(body))
 	}
-	return res, body, nil
 }
 
-// LabelValues gets label values
-func (c *Client) LabelValues(label string) (model.LabelValues, error) {
-	// Cortex currently doesn't support start/end time.
-	value, _, err := c.querierClient.LabelValues(context.Background(), label, time.Time{}, time.Time{})
-	return value, err
+// RetryAfter returns the delay suggested by the Retry-After header of the input
+// response, either a number of seconds or an HTTP date. Returns 0 if the header
+// is missing or invalid.
+func RetryAfter(res *http.Response) time.Duration {
+	value := res.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(time.Now()) {
+		return time.Until(t)
+	}
+	return 0
 }
 
-// LabelNames gets label names
-func (c *Client) LabelNames() ([]string, error) {
-	// Cortex currently doesn't support start/end time.
-	value, _, err := c.querierClient.LabelNames(context.Background(), time.Time{}, time.Time{})
-	return value, err
+// PushTimed pushes the input timeseries like Push, and returns the wall-clock
+// duration of the request along with the response.
+func (c *Client) PushTimed(timeseries []prompb.TimeSeries) (time.Duration, *http.Response, error) {
+	start := time.Now()
+	res, err := c.Push(timeseries)
+	return time.Since(start), res, err
 }
 
-type addOrgIDRoundTripper struct {
-	orgID string
-	next  http.RoundTripper
+// PushBatched pushes the input timeseries in batches of batchSize series, each
+// batch being sent as a separate remote write request, to avoid marshalling all
+// of them at once. It stops at the first non-2xx response, returning the
+// responses received so far along with an error.
+func (c *Client) PushBatched(timeseries []prompb.TimeSeries, batchSize int) ([]*http.Response, error) {
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("invalid batch size %d", batchSize)
+	}
+
+	responses := make([]*http.Response, 0, (len(timeseries)+batchSize-1)/batchSize)
+	for start := 0; start < len(timeseries); start += batchSize {
+		end := start + batchSize
+		if end > len(timeseries) {
+			end = len(timeseries)
+		}
+
+		res, err := c.Push(timeseries[start:end])
+		if err != nil {
+			return responses, fmt.Errorf("pushing series [%d, %d): %v", start, end, err)
+		}
+		responses = append(responses, res)
+
+		if res.StatusCode/100 != 2 {
+			return responses, fmt.Errorf("pushing series [%d, %d) failed with status %d", start, end, res.StatusCode)
+		}
+	}
+
+	return responses, nil
 }
 
-func (r *addOrgIDRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
-	req.Header.Set("X-Scope-OrgID", r.orgID)
+// PushConcurrent pushes each of the input batches as a separate remote write
+// request, using a pool of concurrency workers. All batches are pushed, and the
+// first error encountered, including non-2xx responses, is returned.
+func (c *Client) PushConcurrent(batches [][]prompb.TimeSeries, concurrency int) error {
+	if concurrency <= 0 {
+		return fmt.Errorf("invalid concurrency %d", concurrency)
+	}
 
-	return r.next.RoundTrip(req)
+	var (
+		wg       = sync.WaitGroup{}
+		ch       = make(chan int)
+		firstErr error
+		errOnce  sync.Once
+	)
+
+	for ix := 0; ix < concurrency; ix++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range ch {
+				res, err := c.Push(batches[i])
+				if err == nil && res.StatusCode/100 != 2 {
+					err = fmt.Errorf("pushing batch %d failed with status %d", i, res.StatusCode)
+				} else if err != nil {
+					err = fmt.Errorf("pushing batch %d: %v", i, err)
+				}
+
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+				}
+			}
+		}()
+	}
+
+	for i := range batches {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+
+	return firstErr
 }
 
-// ServerStatus represents a Alertmanager status response
-// TODO: Upgrade to Alertmanager v0.20.0+ and utilize vendored structs
-type ServerStatus struct {
-	Data struct {
-		ConfigYaml string `json:"configYAML"`
-	} `json:"data"`
+// PushTimeseriesAt pushes a single sample for the input metric name and labels,
+// with the given timestamp. This is useful to write samples in the past, e.g. to
+// test out-of-order or backfill ingestion.
+func (c *Client) PushTimeseriesAt(metric string, labels map[string]string, value float64, ts time.Time) (*http.Response, error) {
+	series := prompb.TimeSeries{
+		Labels:  seriesLabels(metric, labels),
+		Samples: []prompb.Sample{{Value: value, Timestamp: timestamp.FromTime(ts)}},
+	}
+
+	return c.Push([]prompb.TimeSeries{series})
 }
 
-// GetAlertmanagerConfig gets the status of an alertmanager instance
-func (c *Client) GetAlertmanagerConfig(ctx context.Context) (*alertConfig.Config, error) {
-	u := c.alertmanagerClient.URL("/api/prom/api/v1/status", nil)
+// PushAndQuery pushes a single sample like PushTimeseriesAt, and then polls an
+// instant query evaluated at the sample timestamp until the pushed value is
+// returned. The timeout applies to the overall push and polling.
+func (c *Client) PushAndQuery(metric string, labels map[string]string, value float64, ts time.Time, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
-	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
+	selector := NewSelector(metric)
+	for name, v := range labels {
+		selector.Eq(name, v)
+	}
+	if err := selector.Err(); err != nil {
+		return err
 	}
 
-	resp, body, err := c.alertmanagerClient.Do(ctx, req)
+	res, err := c.push(ctx, []prompb.TimeSeries{{
+		Labels:  seriesLabels(metric, labels),
+		Samples: []prompb.Sample{{Value: value, Timestamp: timestamp.FromTime(ts)}},
+	}})
 	if err != nil {
-		return nil, err
+		return err
 	}
-
-	if resp.StatusCode == http.StatusNotFound {
-		return nil, ErrNotFound
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("pushing series %s failed with status %d", selector, res.StatusCode)
 	}
 
-	var ss *ServerStatus
-	err = json.Unmarshal(body, &ss)
-	if err != nil {
-		return nil, err
+	var lastErr error
+
+	backoff := util.NewBackoff(ctx, util.BackoffConfig{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 500 * time.Millisecond,
+	})
+
+	for backoff.Ongoing() {
+		result, err := c.query(ctx, selector.String(), ts, nil)
+		if err != nil {
+			// Keep the error of the previous attempt if this one has only been
+			// canceled by the timeout, since it's more useful.
+			if lastErr == nil || ctx.Err() == nil {
+				lastErr = err
+			}
+		} else if vector, ok := result.(model.Vector); !ok {
+			lastErr = fmt.Errorf("expected result type %s, got %s", model.ValVector, result.Type())
+		} else if len(vector) != 1 {
+			lastErr = fmt.Errorf("expected 1 series, got %d", len(vector))
+		} else if float64(vector[0].Value) != value {
+			lastErr = fmt.Errorf("series has value %v, expected %v", vector[0].Value, value)
+		} else {
+			return nil
+		}
+
+		backoff.Wait()
 	}
 
-	cfg := &alertConfig.Config{}
-	err = yaml.Unmarshal([]byte(ss.Data.ConfigYaml), cfg)
+	return fmt.Errorf("timed out waiting for series %s: %v", selector, lastErr)
+}
 
-	return cfg, err
+// CounterPoint is a sample of a counter pushed with PushCounter.
+type CounterPoint struct {
+	Ts time.Time
+	V  float64
 }
 
-// GetRuleGroups gets the status of an alertmanager instance
-func (c *Client) GetRuleGroups() (map[string][]rulefmt.RuleGroup, error) {
-	// Create HTTP request
-	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s/api/prom/rules", c.rulerAddress), nil)
-	if err != nil {
-		return nil, err
+// PushCounter pushes the input points as a single counter series, for the input
+// metric name and labels. Points must have increasing timestamps and
+// non-decreasing values, otherwise an error is returned without pushing anything,
+// so that broken test fixtures are caught before asserting on rate() and alike.
+func (c *Client) PushCounter(metric string, labels map[string]string, points []CounterPoint) (*http.Response, error) {
+	if len(points) == 0 {
+		return nil, errors.New("at least one counter point is required")
 	}
-	req.Header.Set("X-Scope-OrgID", c.orgID)
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
+	series := prompb.TimeSeries{
+		Labels:  seriesLabels(metric, labels),
+		Samples: make([]prompb.Sample, 0, len(points)),
+	}
 
-	// Execute HTTP request
-	res, err := c.httpClient.Do(req.WithContext(ctx))
-	if err != nil {
-		return nil, err
+	for i, p := range points {
+		if i > 0 && !p.Ts.After(points[i-1].Ts) {
+			return nil, fmt.Errorf("counter point %d at %s is not after the previous one at %s", i, p.Ts, points[i-1].Ts)
+		}
+		if i > 0 && p.V < points[i-1].V {
+			return nil, fmt.Errorf("counter point %d decreases from %v to %v", i, points[i-1].V, p.V)
+		}
+		series.Samples = append(series.Samples, prompb.Sample{Value: p.V, Timestamp: timestamp.FromTime(p.Ts)})
 	}
 
-	defer res.Body.Close()
-	rgs := map[string][]rulefmt.RuleGroup{}
+	return c.Push([]prompb.TimeSeries{series})
+}
 
-	data, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
+// seriesLabels returns the labels of the series with the input metric name and
+// labels, sorted by name.
+func seriesLabels(metric string, labels map[string]string) []prompb.Label {
+	result := []prompb.Label{{Name: model.MetricNameLabel, Value: metric}}
+	for name, value := range labels {
+		result = append(result, prompb.Label{Name: name, Value: value})
 	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
 
-	err = yaml.Unmarshal(data, rgs)
-	if err != nil {
-		return nil, err
+// PushRaw sends the input body as is to the remote endpoint, using the given
+// Content-Encoding and Content-Type headers. An empty contentEncoding omits
+// the header. This is useful to test how malformed write requests are handled.
+func (c *Client) PushRaw(body []byte, contentEncoding, contentType string) (*http.Response, error) {
+	res, _, err := c.pushRaw(context.Background(), body, contentEncoding, contentType)
+	return res, err
+}
+
+// pushRaw sends the input body to the remote endpoint like PushRaw, returning
+// the response along with its fully read body. The request is canceled once
+// ctx is done.
+func (c *Client) pushRaw(ctx context.Context, body []byte, contentEncoding, contentType string) (*http.Response, []byte, error) {
+	if strings.Contains(c.orgID, tenantIDsSeparator) {
+		return nil, nil, fmt.Errorf("pushing series requires a single tenant, but got org ID %q", c.orgID)
 	}
 
-	return rgs, nil
+	header := http.Header{}
+	if contentEncoding != "" {
+		header.Set("Content-Encoding", contentEncoding)
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	return c.doRequestContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s/push", c.distributorAddress, c.apiPrefix), bytes.NewReader(body), header)
 }
 
-// SetRuleGroup gets the status of an alertmanager instance
-func (c *Client) SetRuleGroup(rulegroup rulefmt.RuleGroup, namespace string) error {
-	// Create write request
-	data, err := yaml.Marshal(rulegroup)
+// PushExpectingError pushes the input timeseries like Push, and returns nil only
+// if the response status is wantStatus, otherwise an error including the actual
+// status and the response body. This is useful to assert why a push is rejected
+// (e.g. out-of-order samples).
+func (c *Client) PushExpectingError(timeseries []prompb.TimeSeries, wantStatus int) error {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: timeseries})
 	if err != nil {
 		return err
 	}
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", fmt.Sprintf("http://%s/api/prom/rules/%s", c.rulerAddress, url.PathEscape(namespace)), bytes.NewReader(data))
+	res, body, err := c.pushRaw(context.Background(), snappy.Encode(nil, data), "snappy", "application/x-protobuf")
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/yaml")
-	req.Header.Set("X-Scope-OrgID", c.orgID)
-
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
-
-	// Execute HTTP request
-	res, err := c.httpClient.Do(req.WithContext(ctx))
-	if err != nil {
-		return err
+	if res.StatusCode != wantStatus {
+		return fmt.Errorf("pushing series expected to fail with status %d, but got status %d and body %v", wantStatus, res.StatusCode, string(body))
 	}
 
-	defer res.Body.Close()
 	return nil
 }
 
-// DeleteRuleGroup gets the status of an alertmanager instance
-func (c *Client) DeleteRuleGroup(namespace string, groupName string) error {
-	// Create HTTP request
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("http://%s/api/prom/rules/%s/%s", c.rulerAddress, url.PathEscape(namespace), url.PathEscape(groupName)), nil)
-	if err != nil {
-		return err
-	}
+// QueryOption configures optional parameters of a single query.
+type QueryOption func(*queryOptions)
 
-	req.Header.Set("Content-Type", "application/yaml")
-	req.Header.Set("X-Scope-OrgID", c.orgID)
+type queryOptions struct {
+	accept   string
+	warnings *promv1.Warnings
+	headers  http.Header
+	method   string
 
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
+	// keepCompressed returns compressed raw responses as is.
+	keepCompressed bool
 
-	// Execute HTTP request
-	res, err := c.httpClient.Do(req.WithContext(ctx))
-	if err != nil {
-		return err
-	}
+	// maxResponseSize is the max size of raw responses, or 0 if unlimited.
+	maxResponseSize int64
 
-	defer res.Body.Close()
-	return nil
+	// orgID overrides the client org ID, if not empty.
+	orgID string
 }
 
-// userConfig is used to communicate a users alertmanager configs
-type userConfig struct {
-	TemplateFiles      map[string]string `yaml:"template_files"`
-	AlertmanagerConfig string            `yaml:"alertmanager_config"`
+// WithAccept sets the Accept header, to negotiate the response encoding. It's
+// only honored by the raw query methods, because the typed ones can only
+// decode JSON responses.
+func WithAccept(contentType string) QueryOption {
+	return func(o *queryOptions) {
+		o.accept = contentType
+	}
 }
 
-// SetAlertmanagerConfig gets the status of an alertmanager instance
-func (c *Client) SetAlertmanagerConfig(ctx context.Context, amConfig string, templates map[string]string) error {
-	u := c.alertmanagerClient.URL("/api/v1/alerts", nil)
-
-	data, err := yaml.Marshal(&userConfig{
-		AlertmanagerConfig: amConfig,
-		TemplateFiles:      templates,
-	})
+// WithHeader adds a header to a single request, without affecting the other
+// requests issued by the client. The org ID header can't be set this way.
+func WithHeader(name, value string) QueryOption {
+	return func(o *queryOptions) {
+		if o.headers == nil {
+			o.headers = http.Header{}
+		}
+		o.headers.Add(name, value)
+	}
+}
 
-	if err != nil {
-		return err
+// WithMethod forces the HTTP method (GET or POST) used to issue Query and
+// QueryRange requests, and their raw variants. When POST is used, the query
+// parameters are sent as a form-encoded body. If not set, the Prometheus API
+// client picks the method for typed queries, while raw queries use GET.
+func WithMethod(method string) QueryOption {
+	return func(o *queryOptions) {
+		o.method = method
 	}
+}
 
-	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(data))
-	if err != nil {
-		return fmt.Errorf("error creating request: %v", err)
+// WithCompressedBody makes the raw query methods return the response body as
+// received, without decompressing it. By default, raw query responses are
+// requested gzip compressed and transparently decompressed.
+func WithCompressedBody() QueryOption {
+	return func(o *queryOptions) {
+		o.keepCompressed = true
 	}
+}
 
-	resp, body, err := c.alertmanagerClient.Do(ctx, req)
-	if err != nil {
-		return err
+// WithMaxResponseSize makes the raw query methods fail if the response body is
+// larger than maxBytes, instead of reading it all in memory. The limit applies to
+// both the compressed and decompressed body. Defaults to 0, meaning unlimited.
+func WithMaxResponseSize(maxBytes int64) QueryOption {
+	return func(o *queryOptions) {
+		o.maxResponseSize = maxBytes
 	}
+}
 
-	if resp.StatusCode == http.StatusNotFound {
-		return ErrNotFound
+// WithWarnings stores the warnings returned by the server into warnings. It's
+// only honored by the typed query methods.
+func WithWarnings(warnings *promv1.Warnings) QueryOption {
+	return func(o *queryOptions) {
+		o.warnings = warnings
 	}
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("setting config failed with status %d and error %v", resp.StatusCode, string(body))
+// setWarnings stores the input warnings, if requested.
+func (o *queryOptions) setWarnings(warnings promv1.Warnings) {
+	if o.warnings != nil {
+		*o.warnings = warnings
 	}
+}
 
-	return nil
+// header returns the extra headers to send along with raw queries.
+func (o *queryOptions) header() http.Header {
+	header := o.headers.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	if o.accept != "" {
+		header.Set("Accept", o.accept)
+	}
+	return header
 }
 
-// DeleteAlertmanagerConfig gets the status of an alertmanager instance
-func (c *Client) DeleteAlertmanagerConfig(ctx context.Context) error {
-	u := c.alertmanagerClient.URL("/api/v1/alerts", nil)
-	req, err := http.NewRequest(http.MethodDelete, u.String(), nil)
-	if err != nil {
-		return fmt.Errorf("error creating request: %v", err)
+func newQueryOptions(opts []QueryOption) (*queryOptions, error) {
+	o := &queryOptions{}
+	for _, opt := range opts {
+		opt(o)
 	}
 
-	resp, body, err := c.alertmanagerClient.Do(ctx, req)
+	if o.method != "" && o.method != http.MethodGet && o.method != http.MethodPost {
+		return nil, fmt.Errorf("unsupported query method %q", o.method)
+	}
+
+	// Silently overriding the tenant would lead to very confusing test results.
+	if _, ok := o.headers[http.CanonicalHeaderKey("X-Scope-OrgID")]; ok {
+		return nil, errors.New("the X-Scope-OrgID header can't be overridden by a per-request header")
+	}
+
+	return o, nil
+}
+
+// Query runs a query. The query is evaluated at the input time, unless it's zero
+// in which case the time parameter is omitted and the server evaluates the
+// query at its current time.
+func (c *Client) Query(query string, ts time.Time, opts ...QueryOption) (model.Value, error) {
+	return c.query(context.Background(), query, ts, opts)
+}
+
+// query runs a query like Query, canceling it once ctx is done.
+func (c *Client) query(ctx context.Context, query string, ts time.Time, opts []QueryOption) (model.Value, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var value model.Value
+	err = c.doRead(ctx, o, fmt.Sprintf("query %q", query), func(ctx context.Context) error {
+		var warnings promv1.Warnings
+		value, warnings, err = c.querierClient.Query(ctx, query, ts)
+		o.setWarnings(warnings)
+		return err
+	})
+	return value, err
+}
+
+// QueryNow runs an instant query without the time parameter, so that the server
+// evaluates it at its current time, like Query with a zero time.
+func (c *Client) QueryNow(query string, opts ...QueryOption) (model.Value, error) {
+	return c.Query(query, time.Time{}, opts...)
+}
+
+// QueryWithCacheHeaders runs an instant query like Query, and returns the
+// response headers along with the result, so that the cache headers set by the
+// query frontend (e.g. Cache-Control or a custom cache status) can be asserted on.
+func (c *Client) QueryWithCacheHeaders(query string, ts time.Time, opts ...QueryOption) (model.Value, http.Header, error) {
+	res, body, err := c.QueryRaw(query, ts, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	value, err := DecodeQueryResponse(res, body)
+	if err != nil {
+		return nil, res.Header, err
+	}
+	return value, res.Header, nil
+}
+
+// QueryRange runs a range query
+func (c *Client) QueryRange(query string, start, end time.Time, step time.Duration, opts ...QueryOption) (model.Value, error) {
+	return c.queryRange(context.Background(), query, start, end, step, opts)
+}
+
+// queryRange runs a range query like QueryRange, canceling it once ctx is done.
+func (c *Client) queryRange(ctx context.Context, query string, start, end time.Time, step time.Duration, opts []QueryOption) (model.Value, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var value model.Value
+	err = c.doRead(ctx, o, fmt.Sprintf("range query %q", query), func(ctx context.Context) error {
+		var warnings promv1.Warnings
+		value, warnings, err = c.querierClient.QueryRange(ctx, query, promv1.Range{
+			Start: start,
+			End:   end,
+			Step:  step,
+		})
+		o.setWarnings(warnings)
+		return err
+	})
+	return value, err
+}
+
+// QueryRangeStream runs a range query and decodes the response incrementally,
+// calling fn for each series as soon as it has been decoded. Unlike QueryRange,
+// the whole response is never buffered in memory, which makes it suitable for
+// queries returning very large results. Decoding stops at the first error
+// returned by fn. Error responses are returned like by ParseAPIError. The
+// query options apply like to the raw query methods, except WithCompressedBody,
+// since the response must be decompressed to be decoded.
+func (c *Client) QueryRangeStream(query string, start, end time.Time, step time.Duration, fn func(*model.SampleStream) error, opts ...QueryOption) error {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+	params.Set("step", formatDuration(step))
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req, err := c.newQueryRequest(ctx, o, c.apiPrefix+"/api/v1/query_range", params)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	body := newMaxSizeReader(res.Body, o.maxResponseSize)
+	if res.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(body)
+		if err != nil {
+			return fmt.Errorf("decompressing response: %v", err)
+		}
+		defer gz.Close()
+		body = newMaxSizeReader(gz, o.maxResponseSize)
+	}
+
+	if res.StatusCode/100 != 2 {
+		data, err := ioutil.ReadAll(body)
+		if err != nil {
+			return err
+		}
+		return ParseAPIError(res, data)
+	}
+
+	return decodeMatrixStream(body, fn)
+}
+
+// decodeMatrixStream decodes a Prometheus API response containing a matrix,
+// calling fn for each series.
+func decodeMatrixStream(r io.Reader, fn func(*model.SampleStream) error) error {
+	dec := json.NewDecoder(r)
+
+	var status, errorType, errorMsg string
+	err := decodeObject(dec, func(key string) error {
+		switch key {
+		case "status":
+			return dec.Decode(&status)
+		case "errorType":
+			return dec.Decode(&errorType)
+		case "error":
+			return dec.Decode(&errorMsg)
+		case "data":
+			return decodeObject(dec, func(key string) error {
+				switch key {
+				case "resultType":
+					var resultType string
+					if err := dec.Decode(&resultType); err != nil {
+						return err
+					}
+					if resultType != model.ValMatrix.String() {
+						return fmt.Errorf("unexpected result type %q", resultType)
+					}
+					return nil
+				case "result":
+					return decodeArray(dec, func() error {
+						series := &model.SampleStream{}
+						if err := dec.Decode(series); err != nil {
+							return err
+						}
+						return fn(series)
+					})
+				default:
+					return skipValue(dec)
+				}
+			})
+		default:
+			return skipValue(dec)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	if status != "success" {
+		return fmt.Errorf("range query failed with status %q, error type %q and error %v", status, errorType, errorMsg)
+	}
+	return nil
+}
+
+// decodeObject decodes a JSON object token by token, calling fn for each key.
+// fn is expected to consume the key's value.
+func decodeObject(dec *json.Decoder, fn func(key string) error) error {
+	if err := expectDelim(dec, '{'); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		key, ok := token.(string)
+		if !ok {
+			return fmt.Errorf("unexpected JSON token %v", token)
+		}
+
+		if err := fn(key); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, '}')
+}
+
+// decodeArray decodes a JSON array, calling fn for each element. fn is
+// expected to consume the element. A null array is decoded as an empty one.
+func decodeArray(dec *json.Decoder, fn func() error) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if token == nil {
+		return nil
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("unexpected JSON token %v, expected [", token)
+	}
+
+	for dec.More() {
+		if err := fn(); err != nil {
+			return err
+		}
+	}
+
+	return expectDelim(dec, ']')
+}
+
+func expectDelim(dec *json.Decoder, expected json.Delim) error {
+	token, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	if delim, ok := token.(json.Delim); !ok || delim != expected {
+		return fmt.Errorf("unexpected JSON token %v, expected %v", token, expected)
+	}
+	return nil
+}
+
+func skipValue(dec *json.Decoder) error {
+	var skipped json.RawMessage
+	return dec.Decode(&skipped)
+}
+
+// QueryRaw runs an instant query and returns the raw response. The query is
+// evaluated at the input time, unless it's zero in which case the time parameter
+// is omitted and the server evaluates the query at its current time.
+func (c *Client) QueryRaw(query string, ts time.Time, opts ...QueryOption) (*http.Response, []byte, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	if !ts.IsZero() {
+		params.Set("time", formatTime(ts))
+	}
+
+	return c.doQueryRequest(o, c.apiPrefix+"/api/v1/query", params)
+}
+
+// QueryNowRaw runs an instant query without the time parameter, and returns the
+// raw response, like QueryRaw with a zero time.
+func (c *Client) QueryNowRaw(query string, opts ...QueryOption) (*http.Response, []byte, error) {
+	return c.QueryRaw(query, time.Time{}, opts...)
+}
+
+// QueryRawFormat runs an instant query like QueryRaw, requesting the response
+// in the input content type (e.g. ContentTypeJSON or ContentTypeProtobuf)
+// through the Accept header. The raw response is returned along with an error
+// if a successful response has a different Content-Type, because the server
+// didn't honor the content negotiation.
+func (c *Client) QueryRawFormat(query string, ts time.Time, accept string, opts ...QueryOption) (*http.Response, []byte, error) {
+	res, body, err := c.QueryRaw(query, ts, append(opts, WithAccept(accept))...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if contentType := res.Header.Get("Content-Type"); res.StatusCode/100 == 2 && !strings.HasPrefix(contentType, accept) {
+		return res, body, fmt.Errorf("query %q requested the %s content type, but the response has content type %q", query, accept, contentType)
+	}
+
+	return res, body, nil
+}
+
+// QuerySlow runs an instant query like QueryRaw, expected to be slower than
+// minDuration, e.g. to trigger the query frontend slow query log configured with
+// -frontend.log-queries-longer-than. The raw response is returned, so that its
+// headers can be asserted on, along with an error if the query was faster than
+// minDuration, in which case it wouldn't have been treated as slow.
+func (c *Client) QuerySlow(query string, ts time.Time, minDuration time.Duration, opts ...QueryOption) (*http.Response, []byte, error) {
+	start := time.Now()
+	res, body, err := c.QueryRaw(query, ts, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if elapsed := time.Since(start); elapsed < minDuration {
+		return res, body, fmt.Errorf("query %q took %s, which is faster than the min duration %s", query, elapsed, minDuration)
+	}
+
+	return res, body, nil
+}
+
+// QueryRangeRaw runs a range query and returns the raw response.
+func (c *Client) QueryRangeRaw(query string, start, end time.Time, step time.Duration, opts ...QueryOption) (*http.Response, []byte, error) {
+	return c.QueryRangeRawStep(query, start, end, formatDuration(step), opts...)
+}
+
+// QueryRangeRawStep runs a range query and returns the raw response, like
+// QueryRangeRaw, but passes the step through as is, so that it can be any
+// duration string (e.g. "1m") or even an invalid one.
+func (c *Client) QueryRangeRawStep(query string, start, end time.Time, step string, opts ...QueryOption) (*http.Response, []byte, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+	params.Set("step", step)
+
+	return c.doQueryRequest(o, c.apiPrefix+"/api/v1/query_range", params)
+}
+
+// QueryExemplarsRaw runs an exemplars query and returns the raw response. This
+// is useful to assert on the exact serialization of the exemplars, or on the
+// error returned when exemplars are not supported.
+func (c *Client) QueryExemplarsRaw(query string, start, end time.Time, opts ...QueryOption) (*http.Response, []byte, error) {
+	// TODO: neither the Prometheus API nor the querier serve
+	// /api/v1/query_exemplars yet, so the request fails with a 404 status.
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("start", formatTime(start))
+	params.Set("end", formatTime(end))
+
+	return c.doQueryRequest(o, c.apiPrefix+"/api/v1/query_exemplars", params)
+}
+
+// RemoteRead fetches the raw samples of the series matching the input matchers
+// within the input time range, through the Prometheus remote read API.
+func (c *Client) RemoteRead(matchers []*labels.Matcher, start, end time.Time) (model.Matrix, error) {
+	query, err := client.ToQueryRequest(model.TimeFromUnixNano(start.UnixNano()), model.TimeFromUnixNano(end.UnixNano()), matchers)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := proto.Marshal(&client.ReadRequest{Queries: []*client.QueryRequest{query}})
+	if err != nil {
+		return nil, err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", ContentTypeProtobuf)
+	header.Set("Content-Encoding", "snappy")
+	header.Set("X-Prometheus-Remote-Read-Version", "0.1.0")
+
+	res, body, err := c.doRequest(http.MethodPost, fmt.Sprintf("http://%s%s/api/v1/read", c.querierAddress, c.apiPrefix), bytes.NewReader(snappy.Encode(nil, data)), header)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("remote read failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	decoded, err := snappy.Decode(nil, body)
+	if err != nil {
+		return nil, fmt.Errorf("decoding remote read response: %v", err)
+	}
+
+	resp := &client.ReadResponse{}
+	if err := proto.Unmarshal(decoded, resp); err != nil {
+		return nil, fmt.Errorf("decoding remote read response: %v", err)
+	}
+
+	if len(resp.Results) != 1 {
+		return nil, fmt.Errorf("expected 1 remote read result, got %d", len(resp.Results))
+	}
+
+	return client.FromQueryResponse(resp.Results[0]), nil
+}
+
+// DecodeQueryResponse decodes the result of a successful raw query response,
+// encoded either in JSON or protobuf according to the response Content-Type.
+// The protobuf encoding is the one used by the query frontend to encode
+// query range responses.
+func DecodeQueryResponse(res *http.Response, body []byte) (model.Value, error) {
+	if err := ParseAPIError(res, body); err != nil {
+		return nil, err
+	}
+
+	if strings.HasPrefix(res.Header.Get("Content-Type"), ContentTypeProtobuf) {
+		return decodeProtobufQueryResponse(body)
+	}
+	return decodeJSONQueryResponse(body)
+}
+
+func decodeJSONQueryResponse(body []byte) (model.Value, error) {
+	parsed := struct {
+		Data struct {
+			ResultType string          `json:"resultType"`
+			Result     json.RawMessage `json:"result"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, err
+	}
+
+	var value model.Value
+	switch parsed.Data.ResultType {
+	case model.ValScalar.String():
+		value = &model.Scalar{}
+	case model.ValVector.String():
+		value = &model.Vector{}
+	case model.ValMatrix.String():
+		value = &model.Matrix{}
+	case model.ValString.String():
+		value = &model.String{}
+	default:
+		return nil, fmt.Errorf("unexpected result type %q", parsed.Data.ResultType)
+	}
+
+	if err := json.Unmarshal(parsed.Data.Result, value); err != nil {
+		return nil, err
+	}
+
+	// Vectors and matrices have been decoded through a pointer.
+	switch v := value.(type) {
+	case *model.Vector:
+		return *v, nil
+	case *model.Matrix:
+		return *v, nil
+	}
+	return value, nil
+}
+
+func decodeProtobufQueryResponse(body []byte) (model.Value, error) {
+	resp := &queryrange.PrometheusResponse{}
+	if err := resp.Unmarshal(body); err != nil {
+		return nil, err
+	}
+
+	switch resp.Data.ResultType {
+	case model.ValVector.String():
+		vector := make(model.Vector, 0, len(resp.Data.Result))
+		for _, stream := range resp.Data.Result {
+			for _, s := range stream.Samples {
+				vector = append(vector, &model.Sample{
+					Metric:    toModelMetric(stream.Labels),
+					Value:     model.SampleValue(s.Value),
+					Timestamp: model.Time(s.TimestampMs),
+				})
+			}
+		}
+		return vector, nil
+	case model.ValMatrix.String():
+		matrix := make(model.Matrix, 0, len(resp.Data.Result))
+		for _, stream := range resp.Data.Result {
+			values := make([]model.SamplePair, 0, len(stream.Samples))
+			for _, s := range stream.Samples {
+				values = append(values, model.SamplePair{Value: model.SampleValue(s.Value), Timestamp: model.Time(s.TimestampMs)})
+			}
+			matrix = append(matrix, &model.SampleStream{Metric: toModelMetric(stream.Labels), Values: values})
+		}
+		return matrix, nil
+	default:
+		return nil, fmt.Errorf("unexpected result type %q", resp.Data.ResultType)
+	}
+}
+
+func toModelMetric(labels []client.LabelAdapter) model.Metric {
+	metric := make(model.Metric, len(labels))
+	for _, l := range labels {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return metric
+}
+
+// CompareQueryRangeEncodings runs the same range query requesting both the JSON
+// and protobuf encodings, and returns an error describing the differences if
+// the decoded results don't match.
+func (c *Client) CompareQueryRangeEncodings(query string, start, end time.Time, step time.Duration) error {
+	results := map[string]model.Value{}
+
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeProtobuf} {
+		res, body, err := c.QueryRangeRaw(query, start, end, step, WithAccept(contentType))
+		if err != nil {
+			return err
+		}
+
+		value, err := DecodeQueryResponse(res, body)
+		if err != nil {
+			return fmt.Errorf("decoding %s response: %v", contentType, err)
+		}
+		results[contentType] = value
+	}
+
+	jsonResult, protoResult := results[ContentTypeJSON], results[ContentTypeProtobuf]
+	if jsonResult.Type() != protoResult.Type() {
+		return fmt.Errorf("result type mismatch: JSON %s, protobuf %s", jsonResult.Type(), protoResult.Type())
+	}
+
+	// Series ordering isn't guaranteed to be the same across encodings.
+	for _, result := range []model.Value{jsonResult, protoResult} {
+		if matrix, ok := result.(model.Matrix); ok {
+			sort.Sort(matrix)
+		}
+	}
+
+	if jsonResult.String() != protoResult.String() {
+		return fmt.Errorf("results mismatch:\nJSON:\n%s\nprotobuf:\n%s", jsonResult.String(), protoResult.String())
+	}
+	return nil
+}
+
+// APIError is an error returned by a Prometheus-compatible API endpoint.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response, or 0 if unknown.
+	StatusCode int
+	ErrorType  string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s (status %d): %s", e.ErrorType, e.StatusCode, e.Message)
+}
+
+// ParseAPIError returns the error contained in a response returned by a
+// Prometheus-compatible API endpoint, or nil if the request succeeded. Errors
+// in the Prometheus format are returned as *APIError, while any other error
+// is returned as a generic error retaining the body.
+func ParseAPIError(res *http.Response, body []byte) error {
+	if res.StatusCode/100 == 2 {
+		return nil
+	}
+
+	if apiErr, ok := parseAPIErrorBody(res.StatusCode, body); ok {
+		return apiErr
+	}
+	return fmt.Errorf("request failed with status %d and error %v", res.StatusCode, string(body))
+}
+
+// parseAPIErrorBody parses an error body in the Prometheus format, returning
+// false if the body has a different format.
+func parseAPIErrorBody(statusCode int, body []byte) (*APIError, bool) {
+	parsed := struct {
+		Status    string `json:"status"`
+		ErrorType string `json:"errorType"`
+		Error     string `json:"error"`
+	}{}
+	if err := json.Unmarshal(body, &parsed); err != nil || parsed.Status != "error" {
+		return nil, false
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		ErrorType:  parsed.ErrorType,
+		Message:    parsed.Error,
+	}, true
+}
+
+// toAPIError converts an error returned by the Prometheus API client into an
+// *APIError, leaving any other error untouched.
+func toAPIError(err error, statusCode int) error {
+	var promErr *promv1.Error
+	if !errors.As(err, &promErr) {
+		return err
+	}
+
+	// The Prometheus API client only decodes the body of 400 and 422 responses,
+	// keeping the body of any other error response in the error detail.
+	if apiErr, ok := parseAPIErrorBody(statusCode, []byte(promErr.Detail)); ok {
+		return apiErr
+	}
+
+	// Keep the body of error responses not in the Prometheus format (e.g. from
+	// a proxy in front of an unavailable backend), which describes the error.
+	msg := promErr.Msg
+	if detail := strings.TrimSpace(promErr.Detail); detail != "" {
+		msg = fmt.Sprintf("%s: %s", msg, detail)
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		ErrorType:  string(promErr.Type),
+		Message:    msg,
+	}
+}
+
+// LabelValues gets label values
+func (c *Client) LabelValues(label string, opts ...QueryOption) (model.LabelValues, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var value model.LabelValues
+	err = c.doRead(context.Background(), o, fmt.Sprintf("label values query for %q", label), func(ctx context.Context) error {
+		var warnings promv1.Warnings
+		// Cortex currently doesn't support start/end time.
+		value, warnings, err = c.querierClient.LabelValues(ctx, label, time.Time{}, time.Time{})
+		o.setWarnings(warnings)
+		return err
+	})
+	return value, err
+}
+
+// LabelNames gets label names
+func (c *Client) LabelNames(opts ...QueryOption) ([]string, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var value []string
+	err = c.doRead(context.Background(), o, "label names query", func(ctx context.Context) error {
+		var warnings promv1.Warnings
+		// Cortex currently doesn't support start/end time.
+		value, warnings, err = c.querierClient.LabelNames(ctx, time.Time{}, time.Time{})
+		o.setWarnings(warnings)
+		return err
+	})
+	return value, err
+}
+
+// Series finds series by label matchers.
+func (c *Client) Series(matches []string, start, end time.Time, opts ...QueryOption) ([]model.LabelSet, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	var value []model.LabelSet
+	err = c.doRead(context.Background(), o, fmt.Sprintf("series query %q", matches), func(ctx context.Context) error {
+		var warnings promv1.Warnings
+		value, warnings, err = c.querierClient.Series(ctx, matches, start, end)
+		o.setWarnings(warnings)
+		return err
+	})
+	return value, err
+}
+
+// withOrgID overrides the client org ID for a single request.
+func withOrgID(orgID string) QueryOption {
+	return func(o *queryOptions) {
+		o.orgID = orgID
+	}
+}
+
+// QueryFor runs an instant query like Query, but as the input tenant instead
+// of the client one. This is useful to test tenants isolation.
+func (c *Client) QueryFor(orgID, query string, ts time.Time, opts ...QueryOption) (model.Value, error) {
+	if orgID == "" {
+		return nil, errors.New("empty org ID")
+	}
+	return c.Query(query, ts, append(opts, withOrgID(orgID))...)
+}
+
+// QueryRangeFor runs a range query like QueryRange, but as the input tenant
+// instead of the client one.
+func (c *Client) QueryRangeFor(orgID, query string, start, end time.Time, step time.Duration, opts ...QueryOption) (model.Value, error) {
+	if orgID == "" {
+		return nil, errors.New("empty org ID")
+	}
+	return c.QueryRange(query, start, end, step, append(opts, withOrgID(orgID))...)
+}
+
+// LabelValuesFor gets the label values like LabelValues, but as the input
+// tenant instead of the client one.
+func (c *Client) LabelValuesFor(orgID, label string, opts ...QueryOption) (model.LabelValues, error) {
+	if orgID == "" {
+		return nil, errors.New("empty org ID")
+	}
+	return c.LabelValues(label, append(opts, withOrgID(orgID))...)
+}
+
+// LabelNamesFor gets the label names like LabelNames, but as the input tenant
+// instead of the client one.
+func (c *Client) LabelNamesFor(orgID string, opts ...QueryOption) ([]string, error) {
+	if orgID == "" {
+		return nil, errors.New("empty org ID")
+	}
+	return c.LabelNames(append(opts, withOrgID(orgID))...)
+}
+
+// SeriesFor finds the series like Series, but as the input tenant instead of
+// the client one.
+func (c *Client) SeriesFor(orgID string, matches []string, start, end time.Time, opts ...QueryOption) ([]model.LabelSet, error) {
+	if orgID == "" {
+		return nil, errors.New("empty org ID")
+	}
+	return c.Series(matches, start, end, append(opts, withOrgID(orgID))...)
+}
+
+// Targets returns the scrape targets, through the Prometheus targets API. Cortex
+// doesn't scrape targets, so this is only useful against Prometheus compatible
+// setups. Returns ErrNotFound if the endpoint is not supported.
+func (c *Client) Targets() (promv1.TargetsResult, error) {
+	var result promv1.TargetsResult
+
+	err := c.doRead(context.Background(), &queryOptions{}, "targets query", func(ctx context.Context) error {
+		var err error
+		result, err = c.querierClient.Targets(ctx)
+		return err
+	})
+
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return result, ErrNotFound
+	}
+	return result, err
+}
+
+// SeriesCount returns the number of series matching the input label matchers.
+// Matchers are validated before issuing the request.
+func (c *Client) SeriesCount(matches []string, start, end time.Time, opts ...QueryOption) (int, error) {
+	if len(matches) == 0 {
+		return 0, errors.New("at least one series matcher is required")
+	}
+
+	for _, m := range matches {
+		if _, err := parser.ParseMetricSelector(m); err != nil {
+			return 0, fmt.Errorf("invalid series matcher %q: %v", m, err)
+		}
+	}
+
+	series, err := c.Series(matches, start, end, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(series), nil
+}
+
+// LabelValuesRaw runs a label values query and returns the raw response. The
+// matches, start and end are optional: they're omitted if empty or zero.
+func (c *Client) LabelValuesRaw(label string, matches []string, start, end time.Time, opts ...QueryOption) (*http.Response, []byte, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.doQueryRequest(o, fmt.Sprintf("%s/api/v1/label/%s/values", c.apiPrefix, url.PathEscape(label)), labelsParams(matches, start, end))
+}
+
+// LabelNamesRaw runs a label names query and returns the raw response. The
+// matches, start and end are optional: they're omitted if empty or zero.
+func (c *Client) LabelNamesRaw(matches []string, start, end time.Time, opts ...QueryOption) (*http.Response, []byte, error) {
+	o, err := newQueryOptions(opts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return c.doQueryRequest(o, c.apiPrefix+"/api/v1/labels", labelsParams(matches, start, end))
+}
+
+func labelsParams(matches []string, start, end time.Time) url.Values {
+	params := url.Values{}
+	for _, m := range matches {
+		params.Add("match[]", m)
+	}
+	if !start.IsZero() {
+		params.Set("start", formatTime(start))
+	}
+	if !end.IsZero() {
+		params.Set("end", formatTime(end))
+	}
+	return params
+}
+
+type queryOptionsContextKey struct{}
+
+type statusCodeContextKey struct{}
+
+// doRead runs the input read request against the querier API client, converting
+// its error to an *APIError. The request is canceled once ctx is done, or if it
+// doesn't complete within the client timeout, in which case the returned error
+// mentions the input description of the request. If read retries are enabled, the request is
+// retried on connection errors and 5xx responses.
+func (c *Client) doRead(parent context.Context, o *queryOptions, desc string, fn func(ctx context.Context) error) error {
+	// The overall time spent, including retries, is capped by the client timeout.
+	ctx, cancel := context.WithTimeout(parent, c.timeout)
+	defer cancel()
+
+	attempt := func() (int, error) {
+		attemptCtx, statusCode := withStatusCodeRecorder(o.context(ctx))
+		err := fn(attemptCtx)
+		return *statusCode, toAPIError(err, *statusCode)
+	}
+
+	timedOut := func(err error) error {
+		// The client timeout didn't expire if the caller's context is done.
+		if parent.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("%s timed out after %s: %w", desc, c.timeout, err)
+	}
+
+	if c.readRetries == nil {
+		_, err := attempt()
+		if err != nil && ctx.Err() == context.DeadlineExceeded {
+			return timedOut(err)
+		}
+		return err
+	}
+
+	var (
+		attempts   int
+		lastStatus int
+		lastErr    error
+	)
+
+	backoff := util.NewBackoff(ctx, *c.readRetries)
+	for backoff.Ongoing() {
+		lastStatus, lastErr = attempt()
+		attempts++
+
+		if lastErr != nil && ctx.Err() == context.DeadlineExceeded {
+			return timedOut(lastErr)
+		}
+
+		// Never retry on 4xx, so that client errors are reported immediately.
+		if lastErr == nil || (lastStatus > 0 && lastStatus < http.StatusInternalServerError) {
+			return lastErr
+		}
+
+		backoff.Wait()
+	}
+
+	return fmt.Errorf("read request failed after %d attempts (last status %d): %w", attempts, lastStatus, lastErr)
+}
+
+// withStatusCodeRecorder returns a copy of ctx which records the status code
+// of the last response received by addOrgIDRoundTripper.
+func withStatusCodeRecorder(ctx context.Context) (context.Context, *int) {
+	statusCode := new(int)
+	return context.WithValue(ctx, statusCodeContextKey{}, statusCode), statusCode
+}
+
+// context returns a copy of ctx carrying the options, whose extra parameters
+// and headers are added to the outgoing request by addOrgIDRoundTripper.
+func (o *queryOptions) context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, queryOptionsContextKey{}, o)
+}
+
+type userAgentRoundTripper struct {
+	client *Client
+	next   http.RoundTripper
+}
+
+func (r *userAgentRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	req.Header.Set("User-Agent", r.client.userAgent)
+
+	return r.next.RoundTrip(req)
+}
+
+type addOrgIDRoundTripper struct {
+	orgID    string
+	disabled bool
+	next     http.RoundTripper
+}
+
+func (r *addOrgIDRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	o, ok := req.Context().Value(queryOptionsContextKey{}).(*queryOptions)
+
+	// The org ID set for the single request takes precedence.
+	if ok && o.orgID != "" {
+		req.Header.Set("X-Scope-OrgID", o.orgID)
+	} else if !r.disabled {
+		req.Header.Set("X-Scope-OrgID", r.orgID)
+	}
+
+	if ok {
+		// The Accept header is not honored here, because the Prometheus API
+		// client can only decode JSON responses.
+		for name, values := range o.headers {
+			req.Header[name] = values
+		}
+
+		if o.method != "" && o.method != req.Method {
+			if err := setRequestMethod(req, o.method); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	res, err := r.next.RoundTrip(req)
+	if statusCode, ok := req.Context().Value(statusCodeContextKey{}).(*int); ok && res != nil {
+		*statusCode = res.StatusCode
+	}
+
+	return res, err
+}
+
+// formatTime formats a time as unix seconds with millisecond precision, the
+// format used by the Prometheus HTTP API.
+func formatTime(t time.Time) string {
+	return strconv.FormatFloat(float64(t.UnixNano()/int64(time.Millisecond))/1e3, 'f', -1, 64)
+}
+
+// formatDuration formats a duration as (fractional) seconds, the format
+// accepted by all the duration parameters of the Prometheus HTTP API.
+func formatDuration(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', -1, 64)
+}
+
+// doQueryRequest issues a query request to the querier API at the input path,
+// built by newQueryRequest. The response is transparently decompressed unless
+// disabled through the query options.
+func (c *Client) doQueryRequest(o *queryOptions, path string, params url.Values) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	req, err := c.newQueryRequest(ctx, o, path, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := readAllWithLimit(res.Body, o.maxResponseSize)
+	if err != nil || o.keepCompressed || res.Header.Get("Content-Encoding") != "gzip" {
+		return res, body, err
+	}
+
+	// The Content-Encoding header is left untouched, so that it can be asserted on.
+	body, err = gunzip(body, o.maxResponseSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("decompressing response: %v", err)
+	}
+	return res, body, nil
+}
+
+// newQueryRequest returns a query request to the querier API at the input path,
+// using the method configured in the query options (defaults to GET). The
+// response is requested gzip compressed.
+func (c *Client) newQueryRequest(ctx context.Context, o *queryOptions, path string, params url.Values) (*http.Request, error) {
+	addr := fmt.Sprintf("http://%s%s", c.querierAddress, path)
+
+	header := o.header()
+	if header.Get("Accept-Encoding") == "" {
+		header.Set("Accept-Encoding", "gzip")
+	}
+
+	if o.method != http.MethodPost {
+		return c.newRequest(ctx, http.MethodGet, addr+"?"+params.Encode(), nil, header)
+	}
+
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.newRequest(ctx, http.MethodPost, addr, strings.NewReader(params.Encode()), header)
+}
+
+// gunzip decompresses the input data, failing if the decompressed data is
+// larger than limit bytes. A limit of 0 means no limit.
+func gunzip(data []byte, limit int64) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return readAllWithLimit(r, limit)
+}
+
+// setRequestMethod switches the input request to the given method, moving the
+// query parameters between the URL and a form-encoded body accordingly.
+func setRequestMethod(req *http.Request, method string) error {
+	query := req.URL.Query()
+
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+		req.Body.Close()
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return err
+		}
+		for name, values := range form {
+			query[name] = append(query[name], values...)
+		}
+	}
+
+	req.Method = method
+	req.GetBody = nil
+
+	if method == http.MethodGet {
+		req.URL.RawQuery = query.Encode()
+		req.Body = nil
+		req.ContentLength = 0
+		req.Header.Del("Content-Type")
+		return nil
+	}
+
+	body := query.Encode()
+	req.URL.RawQuery = ""
+	req.Body = ioutil.NopCloser(strings.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return nil
+}
+
+// setOrgIDHeader sets the client org ID in the input request, unless the
+// header is disabled.
+func (c *Client) setOrgIDHeader(req *http.Request) {
+	if !c.disableOrgIDHeader {
+		req.Header.Set("X-Scope-OrgID", c.orgID)
+	}
+}
+
+// doRequest executes an HTTP request against the input URL with the input
+// headers, setting the org ID header and applying the client timeout. It returns
+// the response along with its fully read body.
+func (c *Client) doRequest(method, url string, body io.Reader, header http.Header) (*http.Response, []byte, error) {
+	return c.doRequestContext(context.Background(), method, url, body, header)
+}
+
+// doRequestContext executes an HTTP request like doRequest, but also cancels it
+// once ctx is done.
+func (c *Client) doRequestContext(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Response, []byte, error) {
+	return c.doRequestWithLimit(ctx, method, url, body, header, 0)
+}
+
+// doRequestWithLimit executes an HTTP request like doRequestContext, but fails if
+// the response body is larger than maxResponseSize bytes. A limit of 0 means no
+// limit.
+func (c *Client) doRequestWithLimit(ctx context.Context, method, url string, body io.Reader, header http.Header, maxResponseSize int64) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, method, url, body, header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := readAllWithLimit(res.Body, maxResponseSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, data, nil
+}
+
+// newRequest returns an HTTP request against the input URL with the input
+// headers and the org ID header.
+func (c *Client) newRequest(ctx context.Context, method, url string, body io.Reader, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	c.setOrgIDHeader(req)
+	return req, nil
+}
+
+// readAllWithLimit reads the input reader until EOF, failing if more than limit
+// bytes are read. A limit of 0 means no limit.
+func readAllWithLimit(r io.Reader, limit int64) ([]byte, error) {
+	if limit <= 0 {
+		return ioutil.ReadAll(r)
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("response body exceeds the max size of %d bytes", limit)
+	}
+	return data, nil
+}
+
+// maxSizeReader reads from the underlying reader, failing once more than limit
+// bytes are read.
+type maxSizeReader struct {
+	r         io.Reader
+	limit     int64
+	remaining int64
+}
+
+// newMaxSizeReader returns a reader failing once more than limit bytes are read
+// from r. A limit of 0 means no limit, in which case r is returned as is.
+func newMaxSizeReader(r io.Reader, limit int64) io.Reader {
+	if limit <= 0 {
+		return r
+	}
+	return &maxSizeReader{r: r, limit: limit, remaining: limit}
+}
+
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	if m.remaining < 0 {
+		return 0, fmt.Errorf("response body exceeds the max size of %d bytes", m.limit)
+	}
+
+	// Read one byte more than the limit, to detect bodies exceeding it.
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+
+	n, err := m.r.Read(p)
+	m.remaining -= int64(n)
+	if m.remaining < 0 {
+		return n, fmt.Errorf("response body exceeds the max size of %d bytes", m.limit)
+	}
+	return n, err
+}
+
+// GetMetrics scrapes and parses the metrics exposed by the component at the
+// input address.
+func (c *Client) GetMetrics(address string) (map[string]*dto.MetricFamily, error) {
+	res, body, err := c.doRequest(http.MethodGet, fmt.Sprintf("http://%s/metrics", address), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting metrics failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	var tp expfmt.TextParser
+	return tp.TextToMetricFamilies(bytes.NewReader(body))
+}
+
+// WaitSumMetric polls the metrics exposed by the component at the input address
+// until the sum of all series of the input metric equals the expected value, or
+// the timeout expires.
+func (c *Client) WaitSumMetric(address, metricName string, expected float64, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var (
+		sum     float64
+		lastErr error
+	)
+
+	backoff := util.NewBackoff(ctx, util.BackoffConfig{
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 500 * time.Millisecond,
+	})
+
+	for backoff.Ongoing() {
+		families, err := c.GetMetrics(address)
+		if err != nil {
+			lastErr = err
+		} else if family, ok := families[metricName]; !ok {
+			lastErr = fmt.Errorf("metric %s not found in %s metrics", metricName, address)
+		} else if sum = sumMetricValues(family); sum == expected {
+			return nil
+		} else {
+			lastErr = fmt.Errorf("metric %s has value %v, expected %v", metricName, sum, expected)
+		}
+
+		backoff.Wait()
+	}
+
+	return fmt.Errorf("timed out waiting for metric %s: %v", metricName, lastErr)
+}
+
+// WaitOption configures optional settings of WaitForQuery and WaitForQueryResult.
+type WaitOption func(*waitOptions)
+
+type waitOptions struct {
+	backoff   util.BackoffConfig
+	tolerance float64
+	queryOpts []QueryOption
+}
+
+// WithPollInterval polls at a fixed interval, instead of backing off
+// exponentially from 100ms up to 1s.
+func WithPollInterval(interval time.Duration) WaitOption {
+	return func(o *waitOptions) {
+		o.backoff.MinBackoff = interval
+		o.backoff.MaxBackoff = interval
+	}
+}
+
+// WithTolerance sets the absolute tolerance on sample values when comparing
+// the query result with the expected one. Defaults to 0.
+func WithTolerance(tolerance float64) WaitOption {
+	return func(o *waitOptions) {
+		o.tolerance = tolerance
+	}
+}
+
+// WithWaitQueryOptions sets the options of each polled query.
+func WithWaitQueryOptions(opts ...QueryOption) WaitOption {
+	return func(o *waitOptions) {
+		o.queryOpts = opts
+	}
+}
+
+// WaitForQueryResult polls the input instant query, evaluated at the current
+// time, until its result matches the expected one or the context expires.
+// Results are compared with CompareValues. On failure, the last observed result
+// is returned along with the error.
+func (c *Client) WaitForQueryResult(ctx context.Context, query string, expected model.Value, opts ...WaitOption) (model.Value, error) {
+	o := applyWaitOptions(opts)
+
+	var lastDiff error
+	result, err := c.waitForQuery(ctx, query, o, func(v model.Value) bool {
+		_, lastDiff = CompareValues(expected, v, o.tolerance)
+		return lastDiff == nil
+	})
+	if err != nil && lastDiff != nil {
+		return result, fmt.Errorf("%v: %v", err, lastDiff)
+	}
+	return result, err
+}
+
+// WaitForQuery polls the input instant query, evaluated at the current time,
+// until its result satisfies the check function or the context expires. On
+// failure, the last observed result is returned along with the error.
+func (c *Client) WaitForQuery(ctx context.Context, query string, check func(model.Value) bool, opts ...WaitOption) (model.Value, error) {
+	return c.waitForQuery(ctx, query, applyWaitOptions(opts), check)
+}
+
+func (c *Client) waitForQuery(ctx context.Context, query string, o *waitOptions, check func(model.Value) bool) (model.Value, error) {
+	var (
+		result  model.Value
+		lastErr error
+	)
+
+	backoff := util.NewBackoff(ctx, o.backoff)
+	for backoff.Ongoing() {
+		result, lastErr = c.Query(query, time.Now(), o.queryOpts...)
+		if lastErr == nil && check(result) {
+			return result, nil
+		}
+
+		backoff.Wait()
+	}
+
+	if lastErr != nil {
+		return result, fmt.Errorf("timed out waiting for query %s, last error: %w", query, lastErr)
+	}
+	return result, fmt.Errorf("timed out waiting for query %s, last result: %v", query, result)
+}
+
+// WaitForRuleActive polls the Prometheus rules API until the input rule of the
+// input group and namespace exists with the wanted health (e.g. "ok") or
+// alert state (e.g. "firing"), or the context expires. Waiting for a
+// "pending" alerting rule also succeeds once it's firing. On failure, the last
+// observed rule state is included in the error. The poll interval can be set
+// with WithPollInterval.
+func (c *Client) WaitForRuleActive(ctx context.Context, namespace, group, ruleName, wantState string, opts ...WaitOption) (RuleState, error) {
+	o := applyWaitOptions(opts)
+
+	var (
+		last    *RuleState
+		lastErr error
+	)
+
+	backoff := util.NewBackoff(ctx, o.backoff)
+	for backoff.Ongoing() {
+		var groups []RuleGroupState
+		groups, lastErr = c.GetPrometheusRules()
+
+		last = nil
+		for _, g := range groups {
+			if g.File != namespace || g.Name != group {
+				continue
+			}
+			for i := range g.Rules {
+				if g.Rules[i].Name == ruleName {
+					last = &g.Rules[i]
+				}
+			}
+		}
+
+		if last != nil && ruleStateMatches(*last, wantState) {
+			return *last, nil
+		}
+
+		backoff.Wait()
+	}
+
+	desc := fmt.Sprintf("rule %q of group %q in namespace %q to be %s", ruleName, group, namespace, wantState)
+	switch {
+	case lastErr != nil:
+		return RuleState{}, fmt.Errorf("timed out waiting for %s, last error: %w", desc, lastErr)
+	case last == nil:
+		return RuleState{}, fmt.Errorf("timed out waiting for %s, the rule was not found", desc)
+	default:
+		return *last, fmt.Errorf("timed out waiting for %s, last health: %q, last state: %q, last error: %q", desc, last.Health, last.State, last.LastError)
+	}
+}
+
+// ruleStateMatches returns whether the input rule has the wanted health or
+// alert state, a firing alert being also pending.
+func ruleStateMatches(rule RuleState, wantState string) bool {
+	if rule.Health == wantState || rule.State == wantState {
+		return true
+	}
+	return wantState == "pending" && rule.State == "firing"
+}
+
+func applyWaitOptions(opts []WaitOption) *waitOptions {
+	o := &waitOptions{
+		backoff: util.BackoffConfig{
+			MinBackoff: 100 * time.Millisecond,
+			MaxBackoff: time.Second,
+		},
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// sumMetricValues returns the sum of the values of all series of the input family.
+// Histograms and summaries are summed by their sample sum.
+func sumMetricValues(family *dto.MetricFamily) float64 {
+	sum := 0.0
+	for _, m := range family.GetMetric() {
+		switch {
+		case m.GetGauge() != nil:
+			sum += m.GetGauge().GetValue()
+		case m.GetCounter() != nil:
+			sum += m.GetCounter().GetValue()
+		case m.GetUntyped() != nil:
+			sum += m.GetUntyped().GetValue()
+		case m.GetHistogram() != nil:
+			sum += m.GetHistogram().GetSampleSum()
+		case m.GetSummary() != nil:
+			sum += m.GetSummary().GetSampleSum()
+		}
+	}
+	return sum
+}
+
+// ServerStatus represents a Alertmanager status response
+// TODO: Upgrade to Alertmanager v0.20.0+ and utilize vendored structs
+type ServerStatus struct {
+	Data struct {
+		ConfigYaml string `json:"configYAML"`
+	} `json:"data"`
+}
+
+// GetAlertmanagerConfig gets the status of an alertmanager instance
+func (c *Client) GetAlertmanagerConfig(ctx context.Context) (*alertConfig.Config, error) {
+	u := c.alertmanagerClient.URL(c.apiPrefix+"/api/v1/status", nil)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, body, err := c.alertmanagerClient.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	var ss *ServerStatus
+	err = json.Unmarshal(body, &ss)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &alertConfig.Config{}
+	err = yaml.Unmarshal([]byte(ss.Data.ConfigYaml), cfg)
+
+	return cfg, err
+}
+
+// GetAlertmanagerStatus gets the status of an alertmanager instance, as returned
+// by the v2 API.
+func (c *Client) GetAlertmanagerStatus(ctx context.Context) (*models.AlertmanagerStatus, error) {
+	u := c.alertmanagerClient.URL(c.apiPrefix+"/api/v2/status", nil)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, body, err := c.alertmanagerClient.Do(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting alertmanager status failed with status %d and error %v", resp.StatusCode, string(body))
+	}
+
+	status := &models.AlertmanagerStatus{}
+	err = json.Unmarshal(body, status)
+
+	return status, err
+}
+
+// ClusterPeer is a peer of the alertmanager cluster.
+type ClusterPeer struct {
+	Name    string
+	Address string
+}
+
+// GetAlertmanagerPeers returns the peers of the alertmanager cluster, as seen by
+// the alertmanager instance. Returns an empty list if clustering is disabled.
+func (c *Client) GetAlertmanagerPeers(ctx context.Context) ([]ClusterPeer, error) {
+	status, err := c.GetAlertmanagerStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	peers := []ClusterPeer{}
+	if status.Cluster == nil {
+		return peers, nil
+	}
+
+	for _, p := range status.Cluster.Peers {
+		if p == nil {
+			continue
+		}
+
+		peer := ClusterPeer{}
+		if p.Name != nil {
+			peer.Name = *p.Name
+		}
+		if p.Address != nil {
+			peer.Address = *p.Address
+		}
+		peers = append(peers, peer)
+	}
+
+	return peers, nil
+}
+
+// GetRuleGroups gets the rule groups of the tenant, keyed by namespace.
+func (c *Client) GetRuleGroups() (map[string][]RuleGroup, error) {
+	// Create HTTP request
+	req, err := http.NewRequest("GET", fmt.Sprintf("http://%s%s/rules", c.rulerAddress, c.apiPrefix), nil)
+	if err != nil {
+		return nil, err
+	}
+	c.setOrgIDHeader(req)
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	// Execute HTTP request
+	res, err := c.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeRuleGroups(data)
+}
+
+// ListRuleNamespaces returns the sorted namespaces having rule groups for the
+// tenant. The namespaces are read from the keys of the rules listing, without
+// decoding the rule groups. Returns an empty list if the tenant has no rule
+// groups, or ErrNotFound if the ruler API isn't available.
+func (c *Client) ListRuleNamespaces() ([]string, error) {
+	res, body, err := c.doRequest(http.MethodGet, fmt.Sprintf("http://%s%s/rules", c.rulerAddress, c.apiPrefix), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// The ruler responds with 404 when the tenant has no rule groups.
+	if res.StatusCode == http.StatusNotFound && strings.TrimSpace(string(body)) == ruler.ErrNoRuleGroups.Error() {
+		return []string{}, nil
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing rule namespaces failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	namespaces, err := yamlMapKeys(body)
+	if err != nil {
+		return nil, fmt.Errorf("decoding rules listing: %v", err)
+	}
+
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// GetRuleGroup gets a single rule group of the input namespace. Returns
+// ErrNotFound if the rule group doesn't exist.
+func (c *Client) GetRuleGroup(namespace, group string) (RuleGroup, error) {
+	res, body, err := c.doRequest(http.MethodGet, fmt.Sprintf("http://%s%s/rules/%s/%s", c.rulerAddress, c.apiPrefix, url.PathEscape(namespace), url.PathEscape(group)), nil, nil)
+	if err != nil {
+		return RuleGroup{}, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return RuleGroup{}, ErrNotFound
+	}
+
+	if res.StatusCode/100 != 2 {
+		return RuleGroup{}, fmt.Errorf("getting rule group failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	return decodeRuleGroup(body)
+}
+
+// RuleGroupState is the evaluation state of a rule group, as returned by the
+// ruler Prometheus-compatible rules API.
+type RuleGroupState struct {
+	Name           string      `json:"name"`
+	File           string      `json:"file"`
+	Rules          []RuleState `json:"rules"`
+	Interval       float64     `json:"interval"`
+	LastEvaluation time.Time   `json:"lastEvaluation"`
+	EvaluationTime float64     `json:"evaluationTime"`
+}
+
+// RuleState is the evaluation state of a single rule. The alerting specific
+// fields are empty for recording rules. Until the rule is evaluated for the
+// first time, its health is RuleHealthUnknown and its last evaluation is zero.
+type RuleState struct {
+	Name   string            `json:"name"`
+	Query  string            `json:"query"`
+	Labels map[string]string `json:"labels"`
+	Type   string            `json:"type"`
+
+	// Health is one of the RuleHealth constants, and LastError is the error of
+	// the last evaluation if the health is RuleHealthErr.
+	Health    string `json:"health"`
+	LastError string `json:"lastError"`
+
+	// LastEvaluation is the time of the last evaluation, which took
+	// EvaluationTime seconds.
+	LastEvaluation time.Time `json:"lastEvaluation"`
+	EvaluationTime float64   `json:"evaluationTime"`
+
+	// Alerting rules only.
+	State       string            `json:"state"`
+	Duration    float64           `json:"duration"`
+	Annotations map[string]string `json:"annotations"`
+	Alerts      []RuleAlert       `json:"alerts"`
+}
+
+// RuleAlert is an alert generated by an alerting rule evaluated by the ruler.
+type RuleAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	State       string            `json:"state"`
+	ActiveAt    *time.Time        `json:"activeAt"`
+	Value       string            `json:"value"`
+}
+
+// Name returns the name of the alerting rule which generated the alert.
+func (a RuleAlert) Name() string {
+	return a.Labels[model.AlertNameLabel]
+}
+
+// Rule types accepted by GetPrometheusRulesByType.
+const (
+	RuleTypeAlerting  = "alert"
+	RuleTypeRecording = "record"
+)
+
+// Rule health states, as returned by the Prometheus rules API.
+const (
+	RuleHealthOK      = "ok"
+	RuleHealthErr     = "err"
+	RuleHealthUnknown = "unknown"
+)
+
+// RulesFilter selects the rules returned by GetPrometheusRulesFiltered. Empty
+// fields don't filter the rules.
+type RulesFilter struct {
+	// Type is either RuleTypeAlerting or RuleTypeRecording.
+	Type string
+
+	RuleNames  []string
+	RuleGroups []string
+	Files      []string
+}
+
+// GetPrometheusRules returns the evaluation state of the tenant's rule groups.
+func (c *Client) GetPrometheusRules() ([]RuleGroupState, error) {
+	return c.getPrometheusRules(url.Values{})
+}
+
+// GetPrometheusRulesByType returns the evaluation state of the tenant's rule
+// groups, only including the rules of the input type (RuleTypeAlerting or
+// RuleTypeRecording). See GetPrometheusRulesFiltered.
+func (c *Client) GetPrometheusRulesByType(ruleType string) ([]RuleGroupState, error) {
+	return c.GetPrometheusRulesFiltered(RulesFilter{Type: ruleType})
+}
+
+// GetPrometheusRulesFiltered returns the evaluation state of the tenant's rule
+// groups, asking the ruler to only return the rules matching the input filter.
+// Returns an error wrapping ErrRulesFilterNotSupported if the ruler returns
+// rules not matching the filter, because it doesn't implement it.
+func (c *Client) GetPrometheusRulesFiltered(filter RulesFilter) ([]RuleGroupState, error) {
+	params := url.Values{}
+
+	switch filter.Type {
+	case "":
+	case RuleTypeAlerting, RuleTypeRecording:
+		params.Set("type", filter.Type)
+	default:
+		return nil, fmt.Errorf("unsupported rule type %q", filter.Type)
+	}
+
+	for _, name := range filter.RuleNames {
+		params.Add("rule_name[]", name)
+	}
+	for _, group := range filter.RuleGroups {
+		params.Add("rule_group[]", group)
+	}
+	for _, file := range filter.Files {
+		params.Add("file[]", file)
+	}
+
+	groups, err := c.getPrometheusRules(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := filter.check(groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// check returns an error if any of the input groups or rules doesn't match
+// the filter.
+func (f RulesFilter) check(groups []RuleGroupState) error {
+	// The rules API reports the rule type as "alerting" or "recording".
+	ruleTypes := map[string]string{
+		RuleTypeAlerting:  "alerting",
+		RuleTypeRecording: "recording",
+	}
+
+	for _, g := range groups {
+		if len(f.RuleGroups) > 0 && !util.StringsContain(f.RuleGroups, g.Name) {
+			return fmt.Errorf("the ruler returned the rule group %q, not matching the rule_group[] filter: %w", g.Name, ErrRulesFilterNotSupported)
+		}
+		if len(f.Files) > 0 && !util.StringsContain(f.Files, g.File) {
+			return fmt.Errorf("the ruler returned the rule group %q of the file %q, not matching the file[] filter: %w", g.Name, g.File, ErrRulesFilterNotSupported)
+		}
+
+		for _, r := range g.Rules {
+			if f.Type != "" && r.Type != ruleTypes[f.Type] {
+				return fmt.Errorf("the ruler returned the %s rule %q, not matching the type filter: %w", r.Type, r.Name, ErrRulesFilterNotSupported)
+			}
+			if len(f.RuleNames) > 0 && !util.StringsContain(f.RuleNames, r.Name) {
+				return fmt.Errorf("the ruler returned the rule %q, not matching the rule_name[] filter: %w", r.Name, ErrRulesFilterNotSupported)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *Client) getPrometheusRules(params url.Values) ([]RuleGroupState, error) {
+	addr := fmt.Sprintf("http://%s%s/api/v1/rules", c.rulerAddress, c.apiPrefix)
+	if len(params) > 0 {
+		addr += "?" + params.Encode()
+	}
+
+	res, body, err := c.doRequest(http.MethodGet, addr, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting rules failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	parsed := struct {
+		Data struct {
+			Groups []RuleGroupState `json:"groups"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, err
+	}
+
+	return parsed.Data.Groups, nil
+}
+
+// GetPrometheusAlerts returns the tenant's pending and firing alerts, as evaluated
+// by the ruler, regardless of the alertmanager notifications delivery. Returns
+// an empty list if no alert is active, and ErrNotFound if the ruler API is disabled.
+func (c *Client) GetPrometheusAlerts() ([]RuleAlert, error) {
+	res, body, err := c.doRequest(http.MethodGet, fmt.Sprintf("http://%s%s/api/v1/alerts", c.rulerAddress, c.apiPrefix), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting alerts failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	parsed := struct {
+		Data struct {
+			Alerts []RuleAlert `json:"alerts"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, err
+	}
+
+	if parsed.Data.Alerts == nil {
+		return []RuleAlert{}, nil
+	}
+	return parsed.Data.Alerts, nil
+}
+
+// SetRuleGroup uploads the input rule group to the input namespace. Returns a
+// *RuleValidationError if the ruler rejects the rule group as invalid, or
+// ErrNotFound if the ruler API isn't available.
+func (c *Client) SetRuleGroup(rulegroup RuleGroup, namespace string) error {
+	// Create write request
+	data, err := encodeRuleGroup(rulegroup)
+	if err != nil {
+		return err
+	}
+
+	res, body, err := c.doRequest(http.MethodPost, fmt.Sprintf("http://%s%s/rules/%s", c.rulerAddress, c.apiPrefix, url.PathEscape(namespace)), bytes.NewReader(data), http.Header{"Content-Type": []string{"application/yaml"}})
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if res.StatusCode == http.StatusBadRequest {
+		return parseRuleValidationError(namespace, rulegroup, body)
+	}
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("setting rule group failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// DeleteRuleGroup deletes the input rule group of the input namespace.
+// Returns ErrNotFound if the rule group doesn't exist.
+func (c *Client) DeleteRuleGroup(namespace string, groupName string) error {
+	res, body, err := c.doRequest(http.MethodDelete, fmt.Sprintf("http://%s%s/rules/%s/%s", c.rulerAddress, c.apiPrefix, url.PathEscape(namespace), url.PathEscape(groupName)), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("deleting rule group failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// DeleteRuleNamespace deletes all the rule groups of the input namespace.
+// Returns ErrNotFound if the namespace doesn't exist. If the ruler doesn't
+// support deleting a whole namespace, the route only accepts GET and POST and
+// the request fails with a 405 status: a wrapped ErrNotFound is returned, so
+// that callers can fall back to deleting the groups one by one.
+func (c *Client) DeleteRuleNamespace(namespace string) error {
+	res, body, err := c.doRequest(http.MethodDelete, fmt.Sprintf("http://%s%s/rules/%s", c.rulerAddress, c.apiPrefix, url.PathEscape(namespace)), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if res.StatusCode == http.StatusMethodNotAllowed {
+		return fmt.Errorf("the ruler at %s doesn't support deleting a rule namespace: %w", c.rulerAddress, ErrNotFound)
+	}
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("deleting rule namespace failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// userConfig is used to communicate a users alertmanager configs
+type userConfig struct {
+	TemplateFiles      map[string]string `yaml:"template_files"`
+	AlertmanagerConfig string            `yaml:"alertmanager_config"`
+}
+
+// SetAlertmanagerConfig gets the status of an alertmanager instance
+func (c *Client) SetAlertmanagerConfig(ctx context.Context, amConfig string, templates map[string]string) error {
+	u := c.alertmanagerClient.URL("/api/v1/alerts", nil)
+
+	data, err := yaml.Marshal(&userConfig{
+		AlertmanagerConfig: amConfig,
+		TemplateFiles:      templates,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, body, err := c.alertmanagerClient.Do(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("setting config failed with status %d and error %v", resp.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// GetAlertmanagerConfigWithTemplates returns the tenant's alertmanager config
+// along with its template files, as stored by SetAlertmanagerConfig. Returns
+// ErrNotFound if the tenant has no config.
+func (c *Client) GetAlertmanagerConfigWithTemplates(ctx context.Context) (string, map[string]string, error) {
+	u := c.alertmanagerClient.URL("/api/v1/alerts", nil)
+
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, body, err := c.alertmanagerClient.Do(ctx, req)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil, ErrNotFound
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("getting config failed with status %d and error %v", resp.StatusCode, string(body))
+	}
+
+	cfg := &userConfig{}
+	if err := yaml.Unmarshal(body, cfg); err != nil {
+		return "", nil, err
+	}
+
+	return cfg.AlertmanagerConfig, cfg.TemplateFiles, nil
+}
+
+// ValidateAlertmanagerConfig validates the input alertmanager config and templates
+// the same way the alertmanager does when loading a tenant's config, without
+// persisting them. The validation runs locally on the vendored alertmanager
+// code, and nothing is sent to the alertmanager: its API has no dry-run
+// endpoint, and setting then deleting the config wouldn't help, since the
+// config API stores the config without validating it, and would overwrite the
+// tenant's current config.
+func (c *Client) ValidateAlertmanagerConfig(amConfig string, templates map[string]string) error {
+	if _, err := alertConfig.Load(amConfig); err != nil {
+		return fmt.Errorf("invalid alertmanager config: %v", err)
+	}
+
+	for name, content := range templates {
+		if _, err := template.New(name).Funcs(template.FuncMap(alertTemplate.DefaultFuncs)).Parse(content); err != nil {
+			return fmt.Errorf("invalid alertmanager template %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteAlertmanagerConfig gets the status of an alertmanager instance
+func (c *Client) DeleteAlertmanagerConfig(ctx context.Context) error {
+	u := c.alertmanagerClient.URL("/api/v1/alerts", nil)
+	req, err := http.NewRequest(http.MethodDelete, u.String(), nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %v", err)
+	}
+
+	resp, body, err := c.alertmanagerClient.Do(ctx, req)
 	if err != nil {
 		return err
 	}
@@ -358,3 +2694,428 @@ func (c *Client) DeleteAlertmanagerConfig(ctx context.Context) error {
 
 	return nil
 }
+
+// ListAlertmanagerTenants returns the sorted IDs of the tenants whose config is
+// loaded by the multitenant alertmanager at the input address. Returns an error
+// wrapping ErrNotFound if the alertmanager doesn't expose the configs listing.
+func (c *Client) ListAlertmanagerTenants(address string) ([]string, error) {
+	// TODO: the alertmanager only registers /multitenant_alertmanager/status so
+	// far, so the request fails with ErrNotFound until the configs listing lands.
+	res, body, err := c.doRequest(http.MethodGet, fmt.Sprintf("http://%s/multitenant_alertmanager/configs", address), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("the alertmanager at %s doesn't expose the configs listing: %w", address, ErrNotFound)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("listing alertmanager tenants failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	// The listing is a YAML map of the configs keyed by tenant ID.
+	tenants, err := yamlMapKeys(body)
+	if err != nil {
+		return nil, fmt.Errorf("decoding alertmanager configs listing: %v", err)
+	}
+
+	sort.Strings(tenants)
+	return tenants, nil
+}
+
+// yamlMapKeys returns the keys of the top-level YAML map in the input data, in
+// the same order, without decoding the values. An empty document has no keys.
+func yamlMapKeys(data []byte) ([]string, error) {
+	doc := yaml.Node{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected a YAML map at line %d", root.Line)
+	}
+
+	keys := make([]string, 0, len(root.Content)/2)
+	for i := 0; i < len(root.Content); i += 2 {
+		keys = append(keys, root.Content[i].Value)
+	}
+	return keys, nil
+}
+
+// DeleteTenant requests the deletion of all the tenant's data. The purger API
+// is expected to be exposed by the component at the querier address.
+func (c *Client) DeleteTenant() error {
+	// TODO: the purger doesn't register /purger/delete_tenant yet, so the
+	// request fails with a 404 status until the tenant deletion API lands.
+	res, body, err := c.doRequest(http.MethodPost, fmt.Sprintf("http://%s/purger/delete_tenant", c.querierAddress), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("deleting tenant failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// TriggerCompaction requests the compactor at the input address to run a
+// compaction, instead of waiting for the next compaction interval. Returns an
+// error wrapping ErrNotFound if the compactor doesn't expose the trigger endpoint.
+func (c *Client) TriggerCompaction(address string) error {
+	// TODO: the compactor doesn't register /compactor/trigger yet, so this
+	// always returns ErrNotFound until on-demand compactions are supported.
+	res, body, err := c.doRequest(http.MethodPost, fmt.Sprintf("http://%s/compactor/trigger", address), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("the compactor at %s doesn't support triggering a compaction: %w", address, ErrNotFound)
+	}
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("triggering compaction failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// FlushQueryCache requests the query frontend at the querier address to flush
+// the tenant's cached query results. Returns an error wrapping ErrNotFound if
+// the query frontend doesn't expose the cache flush endpoint.
+func (c *Client) FlushQueryCache() error {
+	// TODO: the query frontend doesn't register /frontend/cache/flush yet, so
+	// the request fails with ErrNotFound until the endpoint lands.
+	res, body, err := c.doRequest(http.MethodPost, fmt.Sprintf("http://%s/frontend/cache/flush", c.querierAddress), nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("the query frontend at %s doesn't support flushing the query cache: %w", c.querierAddress, ErrNotFound)
+	}
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("flushing query cache failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// BuildInfoResult contains the build information of a Cortex component.
+type BuildInfoResult struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"buildUser"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// BuildInfo returns the build information of the querier. Returns ErrNotFound
+// if the endpoint is not implemented.
+func (c *Client) BuildInfo() (BuildInfoResult, error) {
+	// TODO: Cortex only routes a subset of the Prometheus API, which doesn't
+	// include /api/v1/status/buildinfo yet, so this returns ErrNotFound.
+	return c.BuildInfoAt(c.querierAddress)
+}
+
+// BuildInfoAt returns the build information of the component at the input address.
+func (c *Client) BuildInfoAt(address string) (BuildInfoResult, error) {
+	result := BuildInfoResult{}
+	_, err := c.getStatus(fmt.Sprintf("http://%s%s/api/v1/status/buildinfo", address, c.apiPrefix), "build info", &result)
+	return result, err
+}
+
+// TSDBStat is a single entry of the TSDB status statistics.
+type TSDBStat struct {
+	Name  string `json:"name"`
+	Value uint64 `json:"value"`
+}
+
+// TSDBHeadStats contains the TSDB head statistics.
+type TSDBHeadStats struct {
+	NumSeries     uint64 `json:"numSeries"`
+	NumLabelPairs int    `json:"numLabelPairs"`
+	ChunkCount    int64  `json:"chunkCount"`
+	MinTime       int64  `json:"minTime"`
+	MaxTime       int64  `json:"maxTime"`
+}
+
+// TSDBStatusResult contains the TSDB cardinality statistics, as returned by the
+// Prometheus /api/v1/status/tsdb endpoint. Statistics are sorted by value, in
+// descending order.
+type TSDBStatusResult struct {
+	HeadStats                   *TSDBHeadStats `json:"headStats,omitempty"`
+	SeriesCountByMetricName     []TSDBStat     `json:"seriesCountByMetricName"`
+	LabelValueCountByLabelName  []TSDBStat     `json:"labelValueCountByLabelName"`
+	MemoryInBytesByLabelName    []TSDBStat     `json:"memoryInBytesByLabelName"`
+	SeriesCountByLabelValuePair []TSDBStat     `json:"seriesCountByLabelValuePair"`
+}
+
+// TSDBStatus returns the TSDB statistics of the tenant, aggregated by the querier.
+// Returns ErrNotFound if the endpoint is not implemented or disabled.
+func (c *Client) TSDBStatus() (TSDBStatusResult, error) {
+	// TODO: neither the querier nor the ingester serve /api/v1/status/tsdb yet,
+	// so this and IngesterTSDBStatus return ErrNotFound.
+	result := TSDBStatusResult{}
+	_, err := c.getStatus(fmt.Sprintf("http://%s%s/api/v1/status/tsdb", c.querierAddress, c.apiPrefix), "TSDB status", &result)
+	return result, err
+}
+
+// IngesterTSDBStatus returns the TSDB statistics of the tenant, local to the
+// ingester at the input address. Returns ErrNotFound if the endpoint is not
+// implemented or disabled.
+func (c *Client) IngesterTSDBStatus(address string) (TSDBStatusResult, error) {
+	result := TSDBStatusResult{}
+	_, err := c.getStatus(fmt.Sprintf("http://%s/api/v1/status/tsdb", address), "TSDB status", &result)
+	return result, err
+}
+
+// RuntimeInfoResult contains the runtime information of a Cortex component.
+type RuntimeInfoResult struct {
+	StartTime           time.Time `json:"startTime"`
+	CWD                 string    `json:"CWD"`
+	ReloadConfigSuccess bool      `json:"reloadConfigSuccess"`
+	LastConfigTime      time.Time `json:"lastConfigTime"`
+	ChunkCount          int64     `json:"chunkCount"`
+	TimeSeriesCount     int64     `json:"timeSeriesCount"`
+	CorruptionCount     int64     `json:"corruptionCount"`
+	GoroutineCount      int       `json:"goroutineCount"`
+	GOMAXPROCS          int       `json:"GOMAXPROCS"`
+	GOGC                string    `json:"GOGC"`
+	GODEBUG             string    `json:"GODEBUG"`
+	StorageRetention    string    `json:"storageRetention"`
+}
+
+// RuntimeInfo returns the runtime information of the querier, along with the
+// raw response body. Returns ErrNotFound if the endpoint is not implemented.
+func (c *Client) RuntimeInfo() (RuntimeInfoResult, []byte, error) {
+	// TODO: the querier routes neither /api/v1/status/runtimeinfo nor
+	// /api/v1/status/flags yet, so this and Flags return ErrNotFound.
+	result := RuntimeInfoResult{}
+	body, err := c.getStatus(fmt.Sprintf("http://%s%s/api/v1/status/runtimeinfo", c.querierAddress, c.apiPrefix), "runtime info", &result)
+	return result, body, err
+}
+
+// Flags returns the command line flags the querier has been started with, along
+// with the raw response body. Returns ErrNotFound if the endpoint is not implemented.
+func (c *Client) Flags() (map[string]string, []byte, error) {
+	result := map[string]string{}
+	body, err := c.getStatus(fmt.Sprintf("http://%s%s/api/v1/status/flags", c.querierAddress, c.apiPrefix), "flags", &result)
+	return result, body, err
+}
+
+// getStatus fetches a Prometheus status endpoint and decodes its data into the
+// input result. The raw response body is returned too. Returns ErrNotFound if
+// the endpoint doesn't exist.
+func (c *Client) getStatus(url, name string, result interface{}) ([]byte, error) {
+	res, body, err := c.doRequest(http.MethodGet, url, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return body, ErrNotFound
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return body, fmt.Errorf("getting %s failed with status %d and error %v", name, res.StatusCode, string(body))
+	}
+
+	parsed := struct {
+		Data interface{} `json:"data"`
+	}{Data: result}
+
+	return body, json.Unmarshal(body, &parsed)
+}
+
+// RingInstance is an instance registered in a ring, as returned by the ring
+// status page of a component.
+type RingInstance struct {
+	ID        string   `json:"id"`
+	State     string   `json:"state"`
+	Address   string   `json:"address"`
+	Timestamp string   `json:"timestamp"`
+	Zone      string   `json:"zone"`
+	Tokens    []uint32 `json:"tokens"`
+}
+
+// GetRulerRing returns the instances of the ruler ring, as seen by the ruler
+// at the input address.
+func (c *Client) GetRulerRing(address string) ([]RingInstance, error) {
+	return c.getRing(address, "/ruler/ring")
+}
+
+// WaitForRulerRing polls the ruler ring, as seen by the ruler at the input
+// address, until it has exactly expectedInstances instances, all ACTIVE, or
+// the context expires. This allows to wait for the ring to converge before
+// uploading rules to sharded rulers. On failure, the last observed instances
+// are included in the error. The poll interval can be set with WithPollInterval.
+func (c *Client) WaitForRulerRing(ctx context.Context, address string, expectedInstances int, opts ...WaitOption) ([]RingInstance, error) {
+	o := applyWaitOptions(opts)
+
+	var (
+		instances []RingInstance
+		lastErr   error
+	)
+
+	backoff := util.NewBackoff(ctx, o.backoff)
+	for backoff.Ongoing() {
+		instances, lastErr = c.GetRulerRing(address)
+		if lastErr == nil && len(instances) == expectedInstances && allRingInstancesActive(instances) {
+			return instances, nil
+		}
+
+		backoff.Wait()
+	}
+
+	if lastErr != nil {
+		return nil, fmt.Errorf("timed out waiting for %d active instances in the ruler ring, last error: %w", expectedInstances, lastErr)
+	}
+
+	states := make([]string, 0, len(instances))
+	for _, i := range instances {
+		states = append(states, fmt.Sprintf("%s=%s", i.ID, i.State))
+	}
+	return instances, fmt.Errorf("timed out waiting for %d active instances in the ruler ring, last instances: [%s]", expectedInstances, strings.Join(states, ", "))
+}
+
+func allRingInstancesActive(instances []RingInstance) bool {
+	for _, i := range instances {
+		if i.State != ring.ACTIVE.String() {
+			return false
+		}
+	}
+	return true
+}
+
+// GetAlertmanagerRing returns the instances of the alertmanager ring, as seen
+// by the alertmanager at the input address. The ring is only available when
+// the alertmanager sharding is supported and enabled.
+func (c *Client) GetAlertmanagerRing(address string) ([]RingInstance, error) {
+	// TODO: the alertmanager doesn't support sharding nor register
+	// /multitenant_alertmanager/ring yet, so the request fails with a 404 status.
+	return c.getRing(address, "/multitenant_alertmanager/ring")
+}
+
+// GetRingInstance returns the input instance of the ring, through the ring
+// status page at ringPath (e.g. /ingester/ring) of the component at the input
+// address. Returns ErrNotFound if the instance isn't registered in the ring.
+func (c *Client) GetRingInstance(address, ringPath, instanceID string) (*RingInstance, error) {
+	instances, err := c.getRing(address, ringPath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range instances {
+		if instances[i].ID == instanceID {
+			return &instances[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ForgetRingInstance removes the input instance from the ring, through the ring
+// status page at ringPath (e.g. /ingester/ring) of the component at the input address.
+func (c *Client) ForgetRingInstance(address, ringPath, instanceID string) error {
+	form := url.Values{}
+	form.Set("forget", instanceID)
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, body, err := c.doRequest(http.MethodPost, fmt.Sprintf("http://%s%s", address, ringPath), strings.NewReader(form.Encode()), header)
+	if err != nil {
+		return err
+	}
+
+	// The ring page replies with a redirect to itself, which may be followed.
+	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusFound {
+		return fmt.Errorf("forgetting ring instance %s failed with status %d and error %v", instanceID, res.StatusCode, string(body))
+	}
+
+	return nil
+}
+
+// getRing fetches the ring status page at the input path of the component at
+// the input address, and returns the ring instances, including their tokens.
+func (c *Client) getRing(address, path string) ([]RingInstance, error) {
+	res, body, err := c.doRequest(http.MethodGet, fmt.Sprintf("http://%s%s?tokens=true", address, path), nil, http.Header{"Accept": []string{ContentTypeJSON}})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting ring %s failed with status %d and error %v", path, res.StatusCode, string(body))
+	}
+
+	// The ring page falls back to HTML if it doesn't support JSON responses.
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) {
+		return nil, fmt.Errorf("getting ring %s returned an HTML page, but a JSON response was expected", path)
+	}
+
+	parsed := struct {
+		Instances []RingInstance `json:"shards"`
+	}{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("decoding ring %s: %v", path, err)
+	}
+
+	return parsed.Instances, nil
+}
+
+// HATrackerEntry is the replica elected by the distributor HA tracker for a
+// cluster of a tenant.
+type HATrackerEntry struct {
+	UserID    string    `json:"userID"`
+	Cluster   string    `json:"cluster"`
+	Replica   string    `json:"replica"`
+	ElectedAt time.Time `json:"electedAt"`
+
+	// UpdateDuration and FailoverDuration are the time left, when the status was
+	// fetched, until the elected replica timestamp is updated and until another
+	// replica can be elected.
+	UpdateDuration   time.Duration `json:"updateDuration"`
+	FailoverDuration time.Duration `json:"failoverDuration"`
+}
+
+// GetHATrackerStatus returns the replicas elected by the HA tracker of the
+// distributor at the input address, sorted by tenant and cluster. Returns an
+// error wrapping ErrNotFound if the distributor doesn't expose the HA tracker
+// status page.
+func (c *Client) GetHATrackerStatus(address string) ([]HATrackerEntry, error) {
+	res, body, err := c.doRequest(http.MethodGet, fmt.Sprintf("http://%s/ha-tracker", address), nil, http.Header{"Accept": []string{ContentTypeJSON}})
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("the distributor at %s doesn't expose the HA tracker status: %w", address, ErrNotFound)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("getting HA tracker status failed with status %d and error %v", res.StatusCode, string(body))
+	}
+
+	// The status page falls back to HTML if it doesn't support JSON responses.
+	if bytes.HasPrefix(bytes.TrimSpace(body), []byte("<")) {
+		return nil, errors.New("getting HA tracker status returned an HTML page, but a JSON response was expected")
+	}
+
+	parsed := struct {
+		Elected []HATrackerEntry `json:"elected"`
+	}{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("decoding HA tracker status: %v", err)
+	}
+
+	return parsed.Elected, nil
+}
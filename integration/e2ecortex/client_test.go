@@ -0,0 +1,3203 @@
+package e2ecortex
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/prometheus/prometheus/promql"
+	"github.com/prometheus/prometheus/util/teststorage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cortexproject/cortex/pkg/distributor"
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+	"github.com/cortexproject/cortex/pkg/querier/queryrange"
+	"github.com/cortexproject/cortex/pkg/ruler"
+	"github.com/cortexproject/cortex/pkg/util"
+	"github.com/cortexproject/cortex/pkg/util/push"
+)
+
+const emptyVectorResponse = `{"status":"success","data":{"resultType":"vector","result":[]}}`
+
+// newTestClient returns a client whose endpoints all point to the input test server.
+func newTestClient(t *testing.T, server *httptest.Server, orgID string) *Client {
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	c, err := NewClient(addr, addr, addr, addr, orgID)
+	require.NoError(t, err)
+	return c
+}
+
+// newFakeDistributor returns a handler decoding snappy-compressed remote write
+// requests, which responds with 400 if the request can't be decoded. Successfully
+// decoded requests are passed to the input push function.
+func newFakeDistributor(push func(*prompb.WriteRequest)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		data, err := snappy.Decode(nil, compressed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		req := &prompb.WriteRequest{}
+		if err := proto.Unmarshal(data, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if push != nil {
+			push(req)
+		}
+	})
+}
+
+func TestClient_PushRaw(t *testing.T) {
+	var received []*prompb.WriteRequest
+
+	server := httptest.NewServer(newFakeDistributor(func(req *prompb.WriteRequest) {
+		received = append(received, req)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	// Truncated snappy data should be rejected.
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}})
+	require.NoError(t, err)
+	compressed := snappy.Encode(nil, data)
+
+	res, err := c.PushRaw(compressed[:len(compressed)/2], "snappy", "application/x-protobuf")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	res, err = c.PushRaw([]byte("garbage"), "snappy", "application/x-protobuf")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	// The untouched payload should be accepted.
+	res, err = c.PushRaw(compressed, "snappy", "application/x-protobuf")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	require.Len(t, received, 1)
+	assert.Equal(t, "series_1", received[0].Timeseries[0].Labels[0].Value)
+}
+
+func TestClient_QueryRange(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "/api/prom/api/v1/query_range", r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+		assert.Equal(t, "15", r.Form.Get("step"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"series_1"},"values":[[1,"1"]]}]}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	result, err := c.QueryRange("series_1", time.Unix(0, 0), time.Unix(60, 0), 15*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, model.ValMatrix, result.Type())
+	assert.Len(t, result.(model.Matrix), 1)
+}
+
+func TestClient_WithOrgIDs(t *testing.T) {
+	var orgIDs []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgIDs = append(orgIDs, r.Header.Get("X-Scope-OrgID"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "tenant-a")
+
+	federated, err := c.WithOrgIDs("tenant-a", "tenant-b")
+	require.NoError(t, err)
+
+	_, err = federated.Query("series_1", time.Now())
+	require.NoError(t, err)
+
+	// The original client should be left untouched.
+	_, err = c.Query("series_1", time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"tenant-a|tenant-b", "tenant-a"}, orgIDs)
+
+	// Pushing with multiple tenants should fail before issuing any request.
+	_, err = federated.Push(nil)
+	require.Error(t, err)
+	assert.Len(t, orgIDs, 2)
+
+	// A single tenant client can still push.
+	single, err := c.WithOrgIDs("tenant-b")
+	require.NoError(t, err)
+	_, err = single.Push(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "tenant-b", orgIDs[2])
+
+	for _, invalid := range [][]string{nil, {""}, {"tenant-a|tenant-b"}} {
+		_, err = c.WithOrgIDs(invalid...)
+		assert.Error(t, err, "org IDs: %v", invalid)
+	}
+}
+
+func TestClient_DeleteTenant(t *testing.T) {
+	statusCode := http.StatusNoContent
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/purger/delete_tenant", r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		w.WriteHeader(statusCode)
+		if statusCode == http.StatusInternalServerError {
+			_, _ = w.Write([]byte("purger not ready"))
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	require.NoError(t, c.DeleteTenant())
+
+	statusCode = http.StatusOK
+	require.NoError(t, c.DeleteTenant())
+
+	statusCode = http.StatusInternalServerError
+	err := c.DeleteTenant()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "purger not ready")
+}
+
+func TestClient_QueryRaw(t *testing.T) {
+	var times []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/query", r.URL.Path)
+		assert.Equal(t, "series_1", r.URL.Query().Get("query"))
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		if _, ok := r.URL.Query()["time"]; ok {
+			times = append(times, r.URL.Query().Get("time"))
+		} else {
+			times = append(times, "<omitted>")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	res, body, err := c.QueryRaw("series_1", time.Unix(1600000000, int64(123456789)))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, emptyVectorResponse, string(body))
+
+	_, _, err = c.QueryRaw("series_1", time.Time{})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"1600000000.123", "<omitted>"}, times)
+}
+
+func TestClient_GetPrometheusRules(t *testing.T) {
+	const rulesResponse = `{
+		"status": "success",
+		"data": {
+			"groups": [{
+				"name": "group-1",
+				"file": "namespace-1",
+				"interval": 10,
+				"lastEvaluation": "2020-07-01T10:00:00Z",
+				"evaluationTime": 0.001,
+				"rules": [{
+					"name": "series_1:sum",
+					"query": "sum(series_1)",
+					"health": "ok",
+					"lastError": "",
+					"type": "recording",
+					"lastEvaluation": "2020-07-01T10:00:00Z",
+					"evaluationTime": 0.0005
+				}, {
+					"state": "inactive",
+					"name": "SeriesMissing",
+					"query": "absent(series_2)",
+					"duration": 60,
+					"labels": {"severity": "page"},
+					"annotations": {},
+					"alerts": [],
+					"health": "err",
+					"lastError": "query timed out",
+					"type": "alerting",
+					"lastEvaluation": "2020-07-01T10:00:00Z",
+					"evaluationTime": 0.0005
+				}]
+			}]
+		}
+	}`
+
+	found := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/rules", r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		if !found {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(rulesResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	groups, err := c.GetPrometheusRules()
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	assert.Equal(t, "group-1", groups[0].Name)
+	assert.Equal(t, "namespace-1", groups[0].File)
+	require.Len(t, groups[0].Rules, 2)
+
+	recording := groups[0].Rules[0]
+	assert.Equal(t, "recording", recording.Type)
+	assert.Equal(t, RuleHealthOK, recording.Health)
+	assert.Empty(t, recording.LastError)
+	assert.Equal(t, time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC), recording.LastEvaluation)
+	assert.Equal(t, 0.0005, recording.EvaluationTime)
+
+	alerting := groups[0].Rules[1]
+	assert.Equal(t, "alerting", alerting.Type)
+	assert.Equal(t, RuleHealthErr, alerting.Health)
+	assert.Equal(t, "query timed out", alerting.LastError)
+	assert.Equal(t, time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC), alerting.LastEvaluation)
+	assert.Equal(t, 0.0005, alerting.EvaluationTime)
+	assert.Equal(t, map[string]string{"severity": "page"}, alerting.Labels)
+
+	found = false
+	_, err = c.GetPrometheusRules()
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClient_GetPrometheusRulesByType(t *testing.T) {
+	var types []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/rules", r.URL.Path)
+		types = append(types, r.URL.Query().Get("type"))
+
+		rule := `{"name":"series_1:sum","query":"sum(series_1)","health":"ok","type":"recording"}`
+		if r.URL.Query().Get("type") == RuleTypeAlerting {
+			rule = `{"state":"firing","name":"SeriesHigh","query":"series_1 > 1","health":"ok","type":"alerting","alerts":[{"state":"firing","value":"2"}]}`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"groups":[{"name":"group-1","file":"namespace-1","rules":[` + rule + `]}]}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	groups, err := c.GetPrometheusRulesByType(RuleTypeRecording)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Len(t, groups[0].Rules, 1)
+	assert.Equal(t, "recording", groups[0].Rules[0].Type)
+	assert.Equal(t, "ok", groups[0].Rules[0].Health)
+
+	groups, err = c.GetPrometheusRulesByType(RuleTypeAlerting)
+	require.NoError(t, err)
+	require.Len(t, groups, 1)
+	require.Len(t, groups[0].Rules, 1)
+	assert.Equal(t, "alerting", groups[0].Rules[0].Type)
+	assert.Len(t, groups[0].Rules[0].Alerts, 1)
+
+	_, err = c.GetPrometheusRulesByType("recording")
+	require.Error(t, err)
+
+	assert.Equal(t, []string{RuleTypeRecording, RuleTypeAlerting}, types)
+}
+
+func TestClient_GetPrometheusRulesFiltered(t *testing.T) {
+	groups := []RuleGroupState{
+		{Name: "group-1", File: "namespace-1", Rules: []RuleState{
+			{Name: "series_1:sum", Query: "sum(series_1)", Health: "ok", Type: "recording"},
+			{Name: "SeriesHigh", Query: "series_1 > 1", Health: "ok", Type: "alerting", State: "inactive"},
+		}},
+		{Name: "group-2", File: "namespace-2", Rules: []RuleState{
+			{Name: "series_2:sum", Query: "sum(series_2)", Health: "ok", Type: "recording"},
+		}},
+	}
+
+	// The fake ruler implements the filters unless told to ignore them.
+	ignoreFilters := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/rules", r.URL.Path)
+		params := r.URL.Query()
+
+		matches := func(values []string, v string) bool {
+			return ignoreFilters || len(values) == 0 || util.StringsContain(values, v)
+		}
+
+		filtered := []RuleGroupState{}
+		for _, g := range groups {
+			if !matches(params["rule_group[]"], g.Name) || !matches(params["file[]"], g.File) {
+				continue
+			}
+
+			rules := []RuleState{}
+			for _, rule := range g.Rules {
+				if params.Get("type") != "" && !ignoreFilters && !strings.HasPrefix(rule.Type, params.Get("type")) {
+					continue
+				}
+				if matches(params["rule_name[]"], rule.Name) {
+					rules = append(rules, rule)
+				}
+			}
+			if len(rules) > 0 {
+				g.Rules = rules
+				filtered = append(filtered, g)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, json.NewEncoder(w).Encode(map[string]interface{}{
+			"status": "success",
+			"data":   map[string]interface{}{"groups": filtered},
+		}))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	ruleNames := func(groups []RuleGroupState) []string {
+		var names []string
+		for _, g := range groups {
+			for _, r := range g.Rules {
+				names = append(names, r.Name)
+			}
+		}
+		return names
+	}
+
+	for _, tc := range []struct {
+		filter   RulesFilter
+		expected []string
+	}{
+		{filter: RulesFilter{}, expected: []string{"series_1:sum", "SeriesHigh", "series_2:sum"}},
+		{filter: RulesFilter{Type: RuleTypeRecording}, expected: []string{"series_1:sum", "series_2:sum"}},
+		{filter: RulesFilter{Type: RuleTypeAlerting}, expected: []string{"SeriesHigh"}},
+		{filter: RulesFilter{RuleNames: []string{"series_2:sum", "SeriesHigh"}}, expected: []string{"SeriesHigh", "series_2:sum"}},
+		{filter: RulesFilter{RuleGroups: []string{"group-2"}}, expected: []string{"series_2:sum"}},
+		{filter: RulesFilter{Files: []string{"namespace-1"}, Type: RuleTypeRecording}, expected: []string{"series_1:sum"}},
+	} {
+		groups, err := c.GetPrometheusRulesFiltered(tc.filter)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, ruleNames(groups), "filter: %+v", tc.filter)
+	}
+
+	// A ruler ignoring the filters should be reported.
+	ignoreFilters = true
+
+	for _, filter := range []RulesFilter{
+		{Type: RuleTypeAlerting},
+		{RuleNames: []string{"SeriesHigh"}},
+		{RuleGroups: []string{"group-2"}},
+		{Files: []string{"namespace-2"}},
+	} {
+		_, err := c.GetPrometheusRulesFiltered(filter)
+		require.Error(t, err)
+		assert.True(t, errors.Is(err, ErrRulesFilterNotSupported), "filter: %+v", filter)
+	}
+
+	_, err := c.GetPrometheusRulesFiltered(RulesFilter{})
+	require.NoError(t, err)
+}
+
+// writeMatrixResponse writes a range query response with the input number of
+// series, each having the input number of samples, without buffering it.
+func writeMatrixResponse(w io.Writer, numSeries, numSamples int) {
+	_, _ = io.WriteString(w, `{"status":"success","data":{"resultType":"matrix","result":[`)
+	for s := 0; s < numSeries; s++ {
+		if s > 0 {
+			_, _ = io.WriteString(w, ",")
+		}
+		_, _ = fmt.Fprintf(w, `{"metric":{"__name__":"series_1","series":"%d"},"values":[`, s)
+		for i := 0; i < numSamples; i++ {
+			if i > 0 {
+				_, _ = io.WriteString(w, ",")
+			}
+			_, _ = fmt.Fprintf(w, `[%d,"%d"]`, i*15, i)
+		}
+		_, _ = io.WriteString(w, "]}")
+	}
+	_, _ = io.WriteString(w, "]}}")
+}
+
+func TestClient_QueryRangeStream(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/query_range", r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		switch r.URL.Query().Get("query") {
+		case "series_1":
+			assert.Equal(t, "15", r.URL.Query().Get("step"))
+			w.Header().Set("Content-Type", "application/json")
+			writeMatrixResponse(w, 3, 5)
+		case "empty":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":null}}`))
+		case "invalid":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		default:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	start, end := time.Unix(0, 0), time.Unix(60, 0)
+
+	var series []*model.SampleStream
+	require.NoError(t, c.QueryRangeStream("series_1", start, end, 15*time.Second, func(s *model.SampleStream) error {
+		series = append(series, s)
+		return nil
+	}))
+	require.Len(t, series, 3)
+	assert.Equal(t, model.LabelValue("2"), series[2].Metric["series"])
+	assert.Len(t, series[2].Values, 5)
+
+	require.NoError(t, c.QueryRangeStream("empty", start, end, 15*time.Second, func(*model.SampleStream) error {
+		t.Fatal("unexpected series")
+		return nil
+	}))
+
+	err := c.QueryRangeStream("invalid", start, end, 15*time.Second, func(*model.SampleStream) error { return nil })
+	require.Error(t, err)
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, &APIError{StatusCode: http.StatusBadRequest, ErrorType: "bad_data", Message: "parse error"}, apiErr)
+
+	err = c.QueryRangeStream("proxy", start, end, 15*time.Second, func(*model.SampleStream) error { return nil })
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bad gateway")
+
+	// Decoding stops at the first callback error.
+	calls := 0
+	err = c.QueryRangeStream("series_1", start, end, 15*time.Second, func(*model.SampleStream) error {
+		calls++
+		return errors.New("stop")
+	})
+	assert.EqualError(t, err, "stop")
+	assert.Equal(t, 1, calls)
+}
+
+func TestClient_QueryRangeStream_Options(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "gzip", r.Header.Get("Accept-Encoding"))
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "series_1", r.PostForm.Get("query"))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		writeMatrixResponse(gz, 3, 5)
+		require.NoError(t, gz.Close())
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	start, end := time.Unix(0, 0), time.Unix(60, 0)
+
+	count := 0
+	require.NoError(t, c.QueryRangeStream("series_1", start, end, 15*time.Second, func(*model.SampleStream) error {
+		count++
+		return nil
+	}, WithMethod(http.MethodPost)))
+	assert.Equal(t, 3, count)
+
+	err := c.QueryRangeStream("series_1", start, end, 15*time.Second, func(*model.SampleStream) error {
+		return nil
+	}, WithMethod(http.MethodPost), WithMaxResponseSize(100))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the max size of 100 bytes")
+}
+
+func BenchmarkClient_QueryRangeStream(b *testing.B) {
+	const (
+		numSeries  = 10000
+		numSamples = 240
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		writeMatrixResponse(w, numSeries, numSamples)
+	}))
+	defer server.Close()
+
+	addr := strings.TrimPrefix(server.URL, "http://")
+	c, err := NewClient("", addr, "", "", "user-1")
+	require.NoError(b, err)
+	c.timeout = time.Minute
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		count := 0
+		err := c.QueryRangeStream("series_1", time.Unix(0, 0), time.Unix(3600, 0), 15*time.Second, func(*model.SampleStream) error {
+			count++
+			return nil
+		})
+		require.NoError(b, err)
+		require.Equal(b, numSeries, count)
+	}
+}
+
+func TestClient_GetPrometheusAlerts(t *testing.T) {
+	const alertsResponse = `{
+		"status": "success",
+		"data": {
+			"alerts": [{
+				"labels": {"alertname": "SeriesMissing", "severity": "page"},
+				"annotations": {"summary": "series_2 is missing"},
+				"state": "firing",
+				"activeAt": "2020-07-01T10:00:00Z",
+				"value": "1e+00"
+			}]
+		}
+	}`
+
+	response := alertsResponse
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/alerts", r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		if response == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	alerts, err := c.GetPrometheusAlerts()
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "SeriesMissing", alerts[0].Name())
+	assert.Equal(t, "series_2 is missing", alerts[0].Annotations["summary"])
+	assert.Equal(t, "firing", alerts[0].State)
+	require.NotNil(t, alerts[0].ActiveAt)
+	assert.Equal(t, time.Date(2020, 7, 1, 10, 0, 0, 0, time.UTC), *alerts[0].ActiveAt)
+
+	// No active alerts should be returned as an empty list.
+	response = `{"status":"success","data":{"alerts":null}}`
+	alerts, err = c.GetPrometheusAlerts()
+	require.NoError(t, err)
+	assert.NotNil(t, alerts)
+	assert.Empty(t, alerts)
+
+	// The ruler API being disabled should be reported.
+	response = ""
+	_, err = c.GetPrometheusAlerts()
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClient_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+
+		switch r.Form.Get("query") {
+		case "invalid(":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+		case "slow":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"timeout","error":"query timed out"}`))
+		case "unsupported":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"execution","error":"unsupported function"}`))
+		case "unavailable":
+			http.Error(w, "no healthy upstream", http.StatusServiceUnavailable)
+		default:
+			http.Error(w, "upstream unavailable", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+
+	// Raw methods.
+	res, body, err := c.QueryRaw("invalid(", now)
+	require.NoError(t, err)
+	var apiErr *APIError
+	require.True(t, errors.As(ParseAPIError(res, body), &apiErr))
+	assert.Equal(t, &APIError{StatusCode: http.StatusBadRequest, ErrorType: "bad_data", Message: "parse error"}, apiErr)
+
+	res, body, err = c.QueryRangeRaw("slow", now.Add(-time.Minute), now, 15*time.Second)
+	require.NoError(t, err)
+	require.True(t, errors.As(ParseAPIError(res, body), &apiErr))
+	assert.Equal(t, &APIError{StatusCode: http.StatusServiceUnavailable, ErrorType: "timeout", Message: "query timed out"}, apiErr)
+
+	res, body, err = c.QueryRaw("other", now)
+	require.NoError(t, err)
+	err = ParseAPIError(res, body)
+	require.Error(t, err)
+	assert.False(t, errors.As(err, &apiErr))
+	assert.Contains(t, err.Error(), "upstream unavailable")
+
+	// Typed methods.
+	_, err = c.Query("invalid(", now)
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, &APIError{StatusCode: http.StatusBadRequest, ErrorType: "bad_data", Message: "parse error"}, apiErr)
+
+	_, err = c.QueryRange("slow", now.Add(-time.Minute), now, 15*time.Second)
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "timeout", apiErr.ErrorType)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+
+	_, err = c.Query("unsupported", now)
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, &APIError{StatusCode: http.StatusUnprocessableEntity, ErrorType: "execution", Message: "unsupported function"}, apiErr)
+
+	// Error responses not in the Prometheus format should keep their body.
+	_, err = c.Query("unavailable", now)
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, &APIError{StatusCode: http.StatusServiceUnavailable, ErrorType: "server_error", Message: "server error: 503: no healthy upstream"}, apiErr)
+}
+
+func TestParseAPIError_Success(t *testing.T) {
+	assert.NoError(t, ParseAPIError(&http.Response{StatusCode: http.StatusOK}, []byte(emptyVectorResponse)))
+}
+
+func TestClient_ValidateAlertmanagerConfig(t *testing.T) {
+	const validConfig = `route:
+  receiver: dummy
+
+receivers:
+  - name: dummy
+`
+
+	c, err := NewClient("", "", "", "", "user-1")
+	require.NoError(t, err)
+
+	require.NoError(t, c.ValidateAlertmanagerConfig(validConfig, map[string]string{
+		"dummy.tmpl": `{{ define "dummy" }}{{ .CommonLabels.alertname | toUpper }}{{ end }}`,
+	}))
+
+	err = c.ValidateAlertmanagerConfig("route:\n  receiver: missing\n", nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `undefined receiver "missing"`)
+
+	err = c.ValidateAlertmanagerConfig(validConfig, map[string]string{"broken.tmpl": `{{ define "broken" }}`})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "broken.tmpl")
+}
+
+func TestClient_QueryRangeRawWithProtobufEncoding(t *testing.T) {
+	protoResponse := &queryrange.PrometheusResponse{
+		Status: "success",
+		Data: queryrange.PrometheusData{
+			ResultType: "matrix",
+			Result: []queryrange.SampleStream{
+				{
+					Labels:  []client.LabelAdapter{{Name: "__name__", Value: "series_2"}},
+					Samples: []client.Sample{{TimestampMs: 15000, Value: 2}},
+				},
+				{
+					Labels:  []client.LabelAdapter{{Name: "__name__", Value: "series_1"}},
+					Samples: []client.Sample{{TimestampMs: 0, Value: 1}, {TimestampMs: 15000, Value: 1.5}},
+				},
+			},
+		},
+	}
+	const jsonResponse = `{"status":"success","data":{"resultType":"matrix","result":[
+		{"metric":{"__name__":"series_1"},"values":[[0,"1"],[15,"1.5"]]},
+		{"metric":{"__name__":"series_2"},"values":[[15,"2"]]}
+	]}}`
+
+	honorAccept := true
+	protoValue := 2.0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if honorAccept && r.Header.Get("Accept") == ContentTypeProtobuf {
+			protoResponse.Data.Result[0].Samples[0].Value = protoValue
+			data, err := protoResponse.Marshal()
+			require.NoError(t, err)
+
+			w.Header().Set("Content-Type", ContentTypeProtobuf)
+			_, _ = w.Write(data)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		_, _ = w.Write([]byte(jsonResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	start, end := time.Unix(0, 0), time.Unix(15, 0)
+
+	res, body, err := c.QueryRangeRaw("series", start, end, 15*time.Second, WithAccept(ContentTypeProtobuf))
+	require.NoError(t, err)
+	assert.Equal(t, ContentTypeProtobuf, res.Header.Get("Content-Type"))
+
+	value, err := DecodeQueryResponse(res, body)
+	require.NoError(t, err)
+	require.Equal(t, model.ValMatrix, value.Type())
+	require.Len(t, value.(model.Matrix), 2)
+	assert.Equal(t, model.SampleValue(2), value.(model.Matrix)[0].Values[0].Value)
+
+	require.NoError(t, c.CompareQueryRangeEncodings("series", start, end, 15*time.Second))
+
+	// A different value in the protobuf response should be detected.
+	protoValue = 3
+	err = c.CompareQueryRangeEncodings("series", start, end, 15*time.Second)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "results mismatch")
+
+	// A server ignoring the Accept header replies with JSON, which is decoded as such.
+	honorAccept = false
+	res, body, err = c.QueryRangeRaw("series", start, end, 15*time.Second, WithAccept(ContentTypeProtobuf))
+	require.NoError(t, err)
+
+	value, err = DecodeQueryResponse(res, body)
+	require.NoError(t, err)
+	assert.Len(t, value.(model.Matrix), 2)
+}
+
+func TestDecodeQueryResponse_JSON(t *testing.T) {
+	res := &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": []string{ContentTypeJSON}}}
+
+	value, err := DecodeQueryResponse(res, []byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"series_1"},"value":[1,"2"]}]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, model.Vector{{Metric: model.Metric{"__name__": "series_1"}, Value: 2, Timestamp: 1000}}, value)
+
+	value, err = DecodeQueryResponse(res, []byte(`{"status":"success","data":{"resultType":"scalar","result":[1,"2"]}}`))
+	require.NoError(t, err)
+	assert.Equal(t, &model.Scalar{Value: 2, Timestamp: 1000}, value)
+
+	res.StatusCode = http.StatusBadRequest
+	_, err = DecodeQueryResponse(res, []byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, "bad_data", apiErr.ErrorType)
+}
+
+type countingRoundTripper struct {
+	requests int
+	next     http.RoundTripper
+}
+
+func (r *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	r.requests++
+	return r.next.RoundTrip(req)
+}
+
+func TestClient_WithTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	}))
+	defer server.Close()
+
+	transport := &countingRoundTripper{next: &http.Transport{MaxIdleConnsPerHost: 100}}
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	c, err := NewClient(addr, addr, addr, addr, "user-1", WithTransport(transport))
+	require.NoError(t, err)
+
+	// Raw HTTP requests.
+	_, err = c.Push(nil)
+	require.NoError(t, err)
+	_, _, err = c.QueryRaw("series_1", time.Now())
+	require.NoError(t, err)
+
+	// Prometheus API client requests.
+	_, err = c.Query("series_1", time.Now())
+	require.NoError(t, err)
+
+	// Clients derived from the original one share the same transport.
+	federated, err := c.WithOrgIDs("user-1", "user-2")
+	require.NoError(t, err)
+	_, err = federated.Query("series_1", time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, 4, transport.requests)
+}
+
+func TestClient_TriggerCompaction(t *testing.T) {
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		switch r.URL.Path {
+		case "/compactor/trigger":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	require.NoError(t, c.TriggerCompaction(addr))
+	assert.Equal(t, []string{"POST /compactor/trigger"}, requests)
+
+	// A compactor not exposing the endpoint should be reported.
+	notFoundServer := httptest.NewServer(http.NotFoundHandler())
+	defer notFoundServer.Close()
+
+	err := c.TriggerCompaction(strings.TrimPrefix(notFoundServer.URL, "http://"))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Contains(t, err.Error(), "doesn't support triggering a compaction")
+}
+
+func TestClient_SetUserAgent(t *testing.T) {
+	var userAgents []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents = append(userAgents, r.Header.Get("User-Agent"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	_, err := c.Push(nil)
+	require.NoError(t, err)
+
+	c.SetUserAgent("custom-agent")
+	_, err = c.Push(nil)
+	require.NoError(t, err)
+	_, err = c.Query("series_1", time.Now())
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{DefaultUserAgent, "custom-agent", "custom-agent"}, userAgents)
+	assert.True(t, strings.HasPrefix(DefaultUserAgent, "cortex-e2e/"))
+}
+
+func TestClient_WithHeader(t *testing.T) {
+	var received []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = append(received, r.Header.Get("X-Priority"))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/prom/api/v1/labels", "/api/prom/api/v1/label/foo/values":
+			_, _ = w.Write([]byte(`{"status":"success","data":[]}`))
+		case "/api/prom/api/v1/query_range":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+		default:
+			_, _ = w.Write([]byte(emptyVectorResponse))
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+	header := WithHeader("X-Priority", "high")
+
+	_, err := c.Query("series_1", now, header)
+	require.NoError(t, err)
+	_, err = c.QueryRange("series_1", now.Add(-time.Minute), now, 15*time.Second, header)
+	require.NoError(t, err)
+	_, _, err = c.QueryRaw("series_1", now, header)
+	require.NoError(t, err)
+	_, err = c.LabelNames(header)
+	require.NoError(t, err)
+	_, err = c.LabelValues("foo", header)
+	require.NoError(t, err)
+
+	// The header is not sticky.
+	_, err = c.Query("series_1", now)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"high", "high", "high", "high", "high", ""}, received)
+
+	// Overriding the tenant is rejected before issuing any request.
+	_, err = c.Query("series_1", now, WithHeader("x-scope-orgid", "user-2"))
+	require.Error(t, err)
+	_, _, err = c.QueryRaw("series_1", now, WithHeader("X-Scope-OrgID", "user-2"))
+	require.Error(t, err)
+	assert.Len(t, received, 6)
+}
+
+func TestClient_SeriesCount(t *testing.T) {
+	var received []*prompb.WriteRequest
+
+	// Fake a distributor storing the pushed series, and a querier returning them.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/prom/push" {
+			newFakeDistributor(func(req *prompb.WriteRequest) {
+				received = append(received, req)
+			}).ServeHTTP(w, r)
+			return
+		}
+
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, []string{`{__name__="series_1"}`}, r.Form["match[]"])
+
+		var series []string
+		for _, req := range received {
+			for _, ts := range req.Timeseries {
+				var labels []string
+				for _, l := range ts.Labels {
+					labels = append(labels, fmt.Sprintf("%q:%q", l.Name, l.Value))
+				}
+				series = append(series, "{"+strings.Join(labels, ",")+"}")
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":[%s]}`, strings.Join(series, ","))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		res, err := c.Push([]prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}, {Name: "instance", Value: strconv.Itoa(i)}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: now.UnixNano() / int64(time.Millisecond)}},
+		}})
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	count, err := c.SeriesCount([]string{`{__name__="series_1"}`}, now.Add(-time.Hour), now)
+	require.NoError(t, err)
+	assert.Equal(t, 3, count)
+
+	_, err = c.SeriesCount([]string{`{__name__=`}, now.Add(-time.Hour), now)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid series matcher")
+
+	_, err = c.SeriesCount(nil, now.Add(-time.Hour), now)
+	require.Error(t, err)
+}
+
+func TestClient_BuildInfo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/status/buildinfo", r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"version":"1.3.0","revision":"abc123","branch":"master","buildUser":"root","buildDate":"20200801","goVersion":"go1.14"}}`))
+	}))
+	defer server.Close()
+
+	oldServer := httptest.NewServer(http.NotFoundHandler())
+	defer oldServer.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	info, err := c.BuildInfo()
+	require.NoError(t, err)
+	assert.Equal(t, BuildInfoResult{
+		Version:   "1.3.0",
+		Revision:  "abc123",
+		Branch:    "master",
+		BuildUser: "root",
+		BuildDate: "20200801",
+		GoVersion: "go1.14",
+	}, info)
+
+	_, err = c.BuildInfoAt(strings.TrimPrefix(oldServer.URL, "http://"))
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClient_PushTimeseriesAt(t *testing.T) {
+	var pushed []prompb.TimeSeries
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/prom/push", newFakeDistributor(func(req *prompb.WriteRequest) {
+		pushed = append(pushed, req.Timeseries...)
+	}))
+	mux.HandleFunc("/api/prom/api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		queryTime, err := strconv.ParseFloat(r.Form.Get("time"), 64)
+		require.NoError(t, err)
+
+		// Return the pushed samples within the default lookback of the query time.
+		result := model.Vector{}
+		for _, series := range pushed {
+			metric := model.Metric{}
+			for _, l := range series.Labels {
+				metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+			}
+			for _, s := range series.Samples {
+				if ts := float64(s.Timestamp) / 1000; ts <= queryTime && ts > queryTime-300 {
+					result = append(result, &model.Sample{Metric: metric, Value: model.SampleValue(s.Value), Timestamp: model.Time(s.Timestamp)})
+				}
+			}
+		}
+
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":` + string(data) + `}}`))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	ts := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	res, err := c.PushTimeseriesAt("series_1", map[string]string{"job": "test", "instance": "a"}, 42, ts)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	require.Len(t, pushed, 1)
+	assert.Equal(t, []prompb.Label{
+		{Name: "__name__", Value: "series_1"},
+		{Name: "instance", Value: "a"},
+		{Name: "job", Value: "test"},
+	}, pushed[0].Labels)
+	assert.Equal(t, []prompb.Sample{{Value: 42, Timestamp: ts.UnixNano() / int64(time.Millisecond)}}, pushed[0].Samples)
+
+	// The sample should be returned only when querying at its timestamp.
+	value, err := c.Query("series_1", ts)
+	require.NoError(t, err)
+	require.Equal(t, model.ValVector, value.Type())
+	require.Len(t, value.(model.Vector), 1)
+	assert.Equal(t, model.SampleValue(42), value.(model.Vector)[0].Value)
+	assert.Equal(t, model.TimeFromUnixNano(ts.UnixNano()), value.(model.Vector)[0].Timestamp)
+
+	value, err = c.Query("series_1", time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, value.(model.Vector))
+}
+
+func TestClient_TSDBStatus(t *testing.T) {
+	const response = `{"status":"success","data":{
+		"headStats":{"numSeries":3,"numLabelPairs":4,"chunkCount":3,"minTime":1000,"maxTime":2000},
+		"seriesCountByMetricName":[{"name":"series_1","value":3}],
+		"labelValueCountByLabelName":[{"name":"pod","value":3},{"name":"__name__","value":1}],
+		"memoryInBytesByLabelName":[{"name":"pod","value":12},{"name":"__name__","value":8}],
+		"seriesCountByLabelValuePair":[{"name":"__name__=series_1","value":3},{"name":"pod=a","value":1}]
+	}}`
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	disabledServer := httptest.NewServer(http.NotFoundHandler())
+	defer disabledServer.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	expected := TSDBStatusResult{
+		HeadStats:                   &TSDBHeadStats{NumSeries: 3, NumLabelPairs: 4, ChunkCount: 3, MinTime: 1000, MaxTime: 2000},
+		SeriesCountByMetricName:     []TSDBStat{{Name: "series_1", Value: 3}},
+		LabelValueCountByLabelName:  []TSDBStat{{Name: "pod", Value: 3}, {Name: "__name__", Value: 1}},
+		MemoryInBytesByLabelName:    []TSDBStat{{Name: "pod", Value: 12}, {Name: "__name__", Value: 8}},
+		SeriesCountByLabelValuePair: []TSDBStat{{Name: "__name__=series_1", Value: 3}, {Name: "pod=a", Value: 1}},
+	}
+
+	status, err := c.TSDBStatus()
+	require.NoError(t, err)
+	assert.Equal(t, expected, status)
+	assert.Equal(t, "pod", status.LabelValueCountByLabelName[0].Name)
+
+	status, err = c.IngesterTSDBStatus(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	assert.Equal(t, expected, status)
+
+	assert.Equal(t, []string{"/api/prom/api/v1/status/tsdb", "/api/v1/status/tsdb"}, paths)
+
+	_, err = c.IngesterTSDBStatus(strings.TrimPrefix(disabledServer.URL, "http://"))
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClient_GetAlertmanagerPeers(t *testing.T) {
+	tests := map[string]struct {
+		response string
+		expected []ClusterPeer
+	}{
+		"two peers": {
+			response: `{
+				"cluster":{"name":"01EGX","status":"ready","peers":[
+					{"name":"01EGX","address":"10.0.0.1:9094"},
+					{"name":"01EGY","address":"10.0.0.2:9094"}
+				]},
+				"config":{"original":""},
+				"uptime":"2020-08-01T10:00:00.000Z",
+				"versionInfo":{"branch":"","buildDate":"","buildUser":"","goVersion":"","revision":"","version":""}
+			}`,
+			expected: []ClusterPeer{
+				{Name: "01EGX", Address: "10.0.0.1:9094"},
+				{Name: "01EGY", Address: "10.0.0.2:9094"},
+			},
+		},
+		"single node": {
+			response: `{
+				"cluster":{"status":"disabled","peers":[]},
+				"config":{"original":""},
+				"uptime":"2020-08-01T10:00:00.000Z",
+				"versionInfo":{"branch":"","buildDate":"","buildUser":"","goVersion":"","revision":"","version":""}
+			}`,
+			expected: []ClusterPeer{},
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "/api/prom/api/v2/status", r.URL.Path)
+
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(testData.response))
+			}))
+			defer server.Close()
+
+			c := newTestClient(t, server, "user-1")
+
+			peers, err := c.GetAlertmanagerPeers(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, testData.expected, peers)
+		})
+	}
+}
+
+func TestClient_RuntimeInfoAndFlags(t *testing.T) {
+	const (
+		runtimeInfoResponse = `{"status":"success","data":{"startTime":"2020-08-01T10:00:00Z","CWD":"/","reloadConfigSuccess":true,"lastConfigTime":"2020-08-01T10:00:00Z","chunkCount":0,"timeSeriesCount":0,"corruptionCount":0,"goroutineCount":42,"GOMAXPROCS":4,"GOGC":"","GODEBUG":"","storageRetention":"15d"}}`
+		flagsResponse       = `{"status":"success","data":{"store.engine":"blocks","querier.query-store-after":"12h"}}`
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		switch r.URL.Path {
+		case "/api/prom/api/v1/status/runtimeinfo":
+			_, _ = w.Write([]byte(runtimeInfoResponse))
+		case "/api/prom/api/v1/status/flags":
+			_, _ = w.Write([]byte(flagsResponse))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	info, body, err := c.RuntimeInfo()
+	require.NoError(t, err)
+	assert.Equal(t, runtimeInfoResponse, string(body))
+	assert.Equal(t, time.Date(2020, 8, 1, 10, 0, 0, 0, time.UTC), info.StartTime)
+	assert.Equal(t, 42, info.GoroutineCount)
+	assert.Equal(t, 4, info.GOMAXPROCS)
+	assert.Equal(t, "15d", info.StorageRetention)
+
+	flags, body, err := c.Flags()
+	require.NoError(t, err)
+	assert.Equal(t, flagsResponse, string(body))
+	assert.Equal(t, map[string]string{"store.engine": "blocks", "querier.query-store-after": "12h"}, flags)
+}
+
+func TestClient_GetMetrics(t *testing.T) {
+	const exposition = `# HELP cortex_distributor_received_samples_total The total number of received samples, excluding rejected and deduped samples.
+# TYPE cortex_distributor_received_samples_total counter
+cortex_distributor_received_samples_total{user="user-1"} 10
+cortex_distributor_received_samples_total{user="user-2"} 5
+# HELP cortex_build_info A metric with a constant '1' value labeled by version.
+# TYPE cortex_build_info gauge
+cortex_build_info{version="1.3.0"} 1
+`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/metrics" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte(exposition))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	families, err := c.GetMetrics(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	require.Len(t, families, 2)
+
+	received := families["cortex_distributor_received_samples_total"]
+	require.NotNil(t, received)
+	require.Len(t, received.GetMetric(), 2)
+	assert.Equal(t, "user-1", received.GetMetric()[0].GetLabel()[0].GetValue())
+	assert.Equal(t, 10.0, received.GetMetric()[0].GetCounter().GetValue())
+
+	_, err = c.GetMetrics(strings.TrimPrefix(server.URL, "http://") + "/unavailable")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 503")
+}
+
+func TestClient_WithReadRetries(t *testing.T) {
+	retries := util.BackoffConfig{MinBackoff: time.Millisecond, MaxBackoff: 5 * time.Millisecond, MaxRetries: 3}
+
+	tests := map[string]struct {
+		opts             []ClientOption
+		statusCodes      []int
+		expectedAttempts int
+		expectedErr      string
+	}{
+		"retries disabled by default": {
+			statusCodes:      []int{http.StatusInternalServerError, http.StatusOK},
+			expectedAttempts: 1,
+			expectedErr:      "status 500",
+		},
+		"retry on 5xx until success": {
+			opts:             []ClientOption{WithReadRetries(retries)},
+			statusCodes:      []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK},
+			expectedAttempts: 3,
+		},
+		"never retry on 4xx": {
+			opts:             []ClientOption{WithReadRetries(retries)},
+			statusCodes:      []int{http.StatusBadRequest, http.StatusOK},
+			expectedAttempts: 1,
+			expectedErr:      "status 400",
+		},
+		"give up after max retries": {
+			opts:             []ClientOption{WithReadRetries(retries)},
+			statusCodes:      []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			expectedAttempts: 3,
+			expectedErr:      "read request failed after 3 attempts (last status 503)",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			attempts := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				statusCode := testData.statusCodes[attempts]
+				attempts++
+
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(statusCode)
+				if statusCode == http.StatusOK {
+					_, _ = w.Write([]byte(`{"status":"success","data":["__name__"]}`))
+				} else {
+					_, _ = w.Write([]byte(`{"status":"error","errorType":"internal","error":"not ready"}`))
+				}
+			}))
+			defer server.Close()
+
+			address := strings.TrimPrefix(server.URL, "http://")
+			c, err := NewClient(address, address, address, address, "user-1", testData.opts...)
+			require.NoError(t, err)
+
+			_, err = c.LabelNames()
+			assert.Equal(t, testData.expectedAttempts, attempts)
+			if testData.expectedErr == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testData.expectedErr)
+
+			var apiErr *APIError
+			assert.True(t, errors.As(err, &apiErr))
+		})
+	}
+}
+
+func TestClient_WaitSumMetric(t *testing.T) {
+	scrapes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scrapes++
+
+		// The metric reaches the expected value at the second scrape.
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = fmt.Fprintf(w, "# TYPE cortex_ingester_memory_series gauge\ncortex_ingester_memory_series{zone=\"a\"} %d\ncortex_ingester_memory_series{zone=\"b\"} %d\n", scrapes, scrapes)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	require.NoError(t, c.WaitSumMetric(address, "cortex_ingester_memory_series", 4, 5*time.Second))
+	assert.Equal(t, 2, scrapes)
+
+	err := c.WaitSumMetric(address, "cortex_ingester_memory_series", 1, 50*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out waiting for metric cortex_ingester_memory_series")
+
+	err = c.WaitSumMetric(address, "cortex_unknown_total", 1, 50*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "metric cortex_unknown_total not found")
+}
+
+func TestClient_QueryExemplarsRaw(t *testing.T) {
+	const (
+		query            = `series_1{job="a b", instance=~"c|d"}`
+		exemplarResponse = `{"status":"success","data":[{"seriesLabels":{"__name__":"series_1","instance":"c","job":"a b"},"exemplars":[{"labels":{"trace_id":"abc"},"value":"1","timestamp":1600000000.123}]}]}`
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		if r.URL.Path != "/api/prom/api/v1/query_exemplars" {
+			http.NotFound(w, r)
+			return
+		}
+
+		assert.Equal(t, query, r.URL.Query().Get("query"))
+		assert.Equal(t, "1600000000.123", r.URL.Query().Get("start"))
+		assert.Equal(t, "1600000060", r.URL.Query().Get("end"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(exemplarResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	res, body, err := c.QueryExemplarsRaw(query, time.Unix(1600000000, int64(123456789)), time.Unix(1600000060, 0))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, exemplarResponse, string(body))
+}
+
+func TestClient_QueryRangeRawStep(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		step := r.URL.Query().Get("step")
+
+		w.Header().Set("Content-Type", "application/json")
+		if d, err := model.ParseDuration(step); err != nil || d <= 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, `{"status":"error","errorType":"bad_data","error":"invalid parameter 'step': cannot parse '%s' to a valid duration"}`, step)
+			return
+		}
+
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	start := time.Unix(1600000000, 0)
+	end := start.Add(time.Hour)
+
+	res, _, err := c.QueryRangeRawStep("series_1", start, end, "15s")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	for _, step := range []string{"0", "abc"} {
+		res, body, err := c.QueryRangeRawStep("series_1", start, end, step)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		apiErr := &APIError{}
+		require.True(t, errors.As(ParseAPIError(res, body), &apiErr))
+		assert.Equal(t, "bad_data", apiErr.ErrorType)
+		assert.Contains(t, apiErr.Message, fmt.Sprintf("'%s'", step))
+	}
+}
+
+func TestClient_NoOrgID(t *testing.T) {
+	var orgIDs []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if values, ok := r.Header["X-Scope-Orgid"]; ok {
+			orgIDs = append(orgIDs, values...)
+		} else {
+			orgIDs = append(orgIDs, "<absent>")
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	for _, opts := range [][]ClientOption{nil, {NoOrgID()}} {
+		c, err := NewClient(address, address, address, address, "user-1", opts...)
+		require.NoError(t, err)
+
+		_, err = c.Push([]prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}})
+		require.NoError(t, err)
+
+		_, err = c.Query("series_1", time.Now())
+		require.NoError(t, err)
+
+		_, _, err = c.QueryRaw("series_1", time.Now())
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{"user-1", "user-1", "user-1", "<absent>", "<absent>", "<absent>"}, orgIDs)
+}
+
+func TestClient_WithMethod(t *testing.T) {
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		requests = append(requests, fmt.Sprintf("%s %s query=%s", r.Method, r.URL.Path, r.Form.Get("query")))
+
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasSuffix(r.URL.Path, "/query_range") {
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+			return
+		}
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		_, err := c.Query("series_1", now, WithMethod(method))
+		require.NoError(t, err)
+
+		_, err = c.QueryRange("series_1", now.Add(-time.Hour), now, time.Minute, WithMethod(method))
+		require.NoError(t, err)
+
+		_, _, err = c.QueryRaw("series_1", now, WithMethod(method))
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, []string{
+		"GET /api/prom/api/v1/query query=series_1",
+		"GET /api/prom/api/v1/query_range query=series_1",
+		"GET /api/prom/api/v1/query query=series_1",
+		"POST /api/prom/api/v1/query query=series_1",
+		"POST /api/prom/api/v1/query_range query=series_1",
+		"POST /api/prom/api/v1/query query=series_1",
+	}, requests)
+
+	_, err := c.Query("series_1", now, WithMethod(http.MethodPut))
+	require.Error(t, err)
+}
+
+func TestClient_GetRulerRing(t *testing.T) {
+	const ringResponse = `{"shards":[
+		{"id":"ruler-1","state":"ACTIVE","address":"10.0.0.1:9095","timestamp":"2020-08-01 10:00:00 +0000 UTC","zone":"","tokens":[10,30]},
+		{"id":"ruler-2","state":"ACTIVE","address":"10.0.0.2:9095","timestamp":"2020-08-01 10:00:00 +0000 UTC","zone":"","tokens":[20]}
+	],"now":"2020-08-01T10:00:05Z"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ruler/ring", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("tokens"))
+
+		if r.Header.Get("Accept") != "application/json" {
+			_, _ = w.Write([]byte("<!DOCTYPE html><html></html>"))
+			return
+		}
+		_, _ = w.Write([]byte(ringResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	instances, err := c.GetRulerRing(address)
+	require.NoError(t, err)
+	assert.Equal(t, []RingInstance{
+		{ID: "ruler-1", State: "ACTIVE", Address: "10.0.0.1:9095", Timestamp: "2020-08-01 10:00:00 +0000 UTC", Tokens: []uint32{10, 30}},
+		{ID: "ruler-2", State: "ACTIVE", Address: "10.0.0.2:9095", Timestamp: "2020-08-01 10:00:00 +0000 UTC", Tokens: []uint32{20}},
+	}, instances)
+
+	htmlServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("\n<!DOCTYPE html><html></html>"))
+	}))
+	defer htmlServer.Close()
+
+	_, err = c.GetRulerRing(strings.TrimPrefix(htmlServer.URL, "http://"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "returned an HTML page")
+
+	notFoundServer := httptest.NewServer(http.NotFoundHandler())
+	defer notFoundServer.Close()
+
+	_, err = c.GetRulerRing(strings.TrimPrefix(notFoundServer.URL, "http://"))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 404")
+}
+
+func TestClient_LabelValuesRawAndLabelNamesRaw(t *testing.T) {
+	var requests []url.Values
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Query())
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/prom/api/v1/label/job/values":
+			_, _ = w.Write([]byte(`{"status":"success","data":["a","b"]}`))
+		case "/api/prom/api/v1/labels":
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			_, _ = w.Write([]byte(`{"status":"error","errorType":"execution","error":"the query hit the max number of series limit"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	start := time.Unix(1600000000, 0)
+	end := start.Add(time.Hour)
+
+	res, body, err := c.LabelValuesRaw("job", []string{`{__name__="series_1"}`, `{__name__="series_2"}`}, start, end)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.JSONEq(t, `{"status":"success","data":["a","b"]}`, string(body))
+
+	res, body, err = c.LabelNamesRaw(nil, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnprocessableEntity, res.StatusCode)
+	assert.JSONEq(t, `{"status":"error","errorType":"execution","error":"the query hit the max number of series limit"}`, string(body))
+
+	require.Len(t, requests, 2)
+	assert.Equal(t, url.Values{
+		"match[]": []string{`{__name__="series_1"}`, `{__name__="series_2"}`},
+		"start":   []string{"1600000000"},
+		"end":     []string{"1600003600"},
+	}, requests[0])
+	assert.Empty(t, requests[1])
+}
+
+func TestClient_GetAlertmanagerRing(t *testing.T) {
+	const ringResponse = `{"shards":[
+		{"id":"alertmanager-1","state":"ACTIVE","address":"10.0.0.1:9095","timestamp":"2020-08-01 10:00:00 +0000 UTC","zone":"zone-a","tokens":[5]},
+		{"id":"alertmanager-2","state":"JOINING","address":"10.0.0.2:9095","timestamp":"2020-08-01 10:00:00 +0000 UTC","zone":"zone-b","tokens":[]}
+	],"now":"2020-08-01T10:00:05Z"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/multitenant_alertmanager/ring", r.URL.Path)
+		assert.Equal(t, "true", r.URL.Query().Get("tokens"))
+		assert.Equal(t, "application/json", r.Header.Get("Accept"))
+
+		_, _ = w.Write([]byte(ringResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	instances, err := c.GetAlertmanagerRing(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	assert.Equal(t, []RingInstance{
+		{ID: "alertmanager-1", State: "ACTIVE", Address: "10.0.0.1:9095", Timestamp: "2020-08-01 10:00:00 +0000 UTC", Zone: "zone-a", Tokens: []uint32{5}},
+		{ID: "alertmanager-2", State: "JOINING", Address: "10.0.0.2:9095", Timestamp: "2020-08-01 10:00:00 +0000 UTC", Zone: "zone-b", Tokens: []uint32{}},
+	}, instances)
+}
+
+func TestClient_ForgetRingInstance(t *testing.T) {
+	var forgotten []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/ingester/ring" {
+			http.NotFound(w, r)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			assert.Equal(t, "application/x-www-form-urlencoded", r.Header.Get("Content-Type"))
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			forgotten = append(forgotten, string(body))
+
+			w.Header().Set("Location", "#")
+			w.WriteHeader(http.StatusFound)
+			return
+		}
+
+		_, _ = w.Write([]byte("<!DOCTYPE html><html></html>"))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	require.NoError(t, c.ForgetRingInstance(address, "/ingester/ring", "ingester-1"))
+	require.NoError(t, c.ForgetRingInstance(address, "/ingester/ring", "ingester 2&3"))
+	assert.Equal(t, []string{"forget=ingester-1", "forget=ingester+2%263"}, forgotten)
+
+	err := c.ForgetRingInstance(address, "/unknown/ring", "ingester-1")
+	require.Error(t, err)
+}
+
+func TestClient_WaitForQueryResult(t *testing.T) {
+	queries := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries++
+
+		// The series shows up at the third query.
+		w.Header().Set("Content-Type", "application/json")
+		if queries < 3 {
+			_, _ = w.Write([]byte(emptyVectorResponse))
+			return
+		}
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"series_1"},"value":[1600000000,"1.05"]}]}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	expected := model.Vector{{Metric: model.Metric{"__name__": "series_1"}, Value: 1, Timestamp: 1600000000000}}
+
+	result, err := c.WaitForQueryResult(context.Background(), "series_1", expected, WithPollInterval(time.Millisecond), WithTolerance(0.1))
+	require.NoError(t, err)
+	assert.Equal(t, 3, queries)
+	assert.Len(t, result, 1)
+
+	// Without tolerance, the result never matches.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	result, err = c.WaitForQueryResult(ctx, "series_1", expected, WithPollInterval(time.Millisecond))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds tolerance")
+	assert.Len(t, result, 1)
+
+	result, err = c.WaitForQuery(context.Background(), "series_1", func(v model.Value) bool {
+		return len(v.(model.Vector)) == 1
+	}, WithPollInterval(time.Millisecond))
+	require.NoError(t, err)
+	assert.Len(t, result, 1)
+}
+
+func TestClient_PushBatched(t *testing.T) {
+	var (
+		received  [][]string
+		failAfter = -1
+	)
+
+	distributor := newFakeDistributor(func(req *prompb.WriteRequest) {
+		names := []string{}
+		for _, ts := range req.Timeseries {
+			names = append(names, ts.Labels[0].Value)
+		}
+		received = append(received, names)
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failAfter >= 0 && len(received) >= failAfter {
+			http.Error(w, "ingestion rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		distributor.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	var series []prompb.TimeSeries
+	for i := 0; i < 6; i++ {
+		series = append(series, prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: fmt.Sprintf("series_%d", i)}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		})
+	}
+
+	responses, err := c.PushBatched(series, 2)
+	require.NoError(t, err)
+	assert.Len(t, responses, 3)
+	assert.Equal(t, [][]string{{"series_0", "series_1"}, {"series_2", "series_3"}, {"series_4", "series_5"}}, received)
+
+	// A non-2xx response should abort the push.
+	received = nil
+	failAfter = 1
+
+	responses, err = c.PushBatched(series, 2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pushing series [2, 4) failed with status 429")
+	require.Len(t, responses, 2)
+	assert.Equal(t, http.StatusTooManyRequests, responses[1].StatusCode)
+	assert.Len(t, received, 1)
+
+	_, err = c.PushBatched(series, 0)
+	require.Error(t, err)
+}
+
+func TestClient_PushConcurrent(t *testing.T) {
+	var (
+		mx          sync.Mutex
+		received    int
+		inflight    int
+		maxInflight int
+	)
+
+	distributor := newFakeDistributor(func(req *prompb.WriteRequest) {
+		mx.Lock()
+		received++
+		mx.Unlock()
+	})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		inflight++
+		if inflight > maxInflight {
+			maxInflight = inflight
+		}
+		mx.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+		distributor.ServeHTTP(w, r)
+
+		mx.Lock()
+		inflight--
+		mx.Unlock()
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	batches := make([][]prompb.TimeSeries, 20)
+	for i := range batches {
+		batches[i] = []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: fmt.Sprintf("series_%d", i)}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}}
+	}
+
+	require.NoError(t, c.PushConcurrent(batches, 3))
+	assert.Equal(t, 20, received)
+	assert.LessOrEqual(t, maxInflight, 3)
+
+	// An invalid batch should be reported as error, while others are still pushed.
+	received = 0
+	batches[5] = []prompb.TimeSeries{{Labels: []prompb.Label{{Name: "__name__", Value: "series_5"}}}}
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		if bytes.Contains(data, []byte("series_5")) {
+			http.Error(w, "invalid series", http.StatusBadRequest)
+			return
+		}
+		mx.Lock()
+		received++
+		mx.Unlock()
+	}))
+	defer failing.Close()
+
+	c = newTestClient(t, failing, "user-1")
+	err := c.PushConcurrent(batches, 3)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pushing batch 5 failed with status 400")
+	assert.Equal(t, 19, received)
+}
+
+func TestClient_PrometheusAPI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/status/runtimeinfo", r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+		assert.Equal(t, DefaultUserAgent, r.Header.Get("User-Agent"))
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"startTime":"2020-08-01T10:00:00Z","CWD":"/","goroutineCount":42,"GOMAXPROCS":4,"storageRetention":"15d"}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	info, err := c.PrometheusAPI().Runtimeinfo(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 42, info.GoroutineCount)
+	assert.Equal(t, "15d", info.StorageRetention)
+}
+
+func TestClient_ReadTimeout(t *testing.T) {
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Never respond, until the test ends.
+		select {
+		case <-r.Context().Done():
+		case <-unblock:
+		}
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	c := newTestClient(t, server, "user-1")
+	c.timeout = 50 * time.Millisecond
+
+	tests := map[string]struct {
+		call        func() error
+		expectedErr string
+	}{
+		"Query": {
+			call: func() error {
+				_, err := c.Query("series_1", time.Now())
+				return err
+			},
+			expectedErr: `query "series_1" timed out after 50ms`,
+		},
+		"QueryRange": {
+			call: func() error {
+				_, err := c.QueryRange("series_1", time.Now().Add(-time.Hour), time.Now(), time.Minute)
+				return err
+			},
+			expectedErr: `range query "series_1" timed out after 50ms`,
+		},
+		"LabelValues": {
+			call: func() error {
+				_, err := c.LabelValues("job")
+				return err
+			},
+			expectedErr: `label values query for "job" timed out after 50ms`,
+		},
+		"LabelNames": {
+			call: func() error {
+				_, err := c.LabelNames()
+				return err
+			},
+			expectedErr: "label names query timed out after 50ms",
+		},
+	}
+
+	for testName, testData := range tests {
+		t.Run(testName, func(t *testing.T) {
+			start := time.Now()
+			err := testData.call()
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), testData.expectedErr)
+			assert.Less(t, int64(time.Since(start)), int64(5*time.Second))
+		})
+	}
+}
+
+func TestClient_Targets(t *testing.T) {
+	const targetsResponse = `{"status":"success","data":{
+		"activeTargets":[{"discoveredLabels":{"__address__":"localhost:9090"},"labels":{"instance":"localhost:9090","job":"prometheus"},"scrapeUrl":"http://localhost:9090/metrics","lastError":"","lastScrape":"2020-08-01T10:00:00Z","health":"up"}],
+		"droppedTargets":[{"discoveredLabels":{"__address__":"localhost:9091"}}]
+	}}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/prom/api/v1/targets" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(targetsResponse))
+	}))
+	defer server.Close()
+
+	unsupported := httptest.NewServer(http.NotFoundHandler())
+	defer unsupported.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	targets, err := c.Targets()
+	require.NoError(t, err)
+	require.Len(t, targets.Active, 1)
+	assert.Equal(t, model.LabelValue("prometheus"), targets.Active[0].Labels["job"])
+	assert.Equal(t, promv1.HealthGood, targets.Active[0].Health)
+	require.Len(t, targets.Dropped, 1)
+	assert.Equal(t, "localhost:9091", targets.Dropped[0].DiscoveredLabels["__address__"])
+
+	c = newTestClient(t, unsupported, "user-1")
+	_, err = c.Targets()
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClient_QueryFor(t *testing.T) {
+	var orgIDs []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgIDs = append(orgIDs, r.Header.Get("X-Scope-OrgID"))
+
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/api/prom/api/v1/query_range":
+			_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[]}}`))
+		case "/api/prom/api/v1/query":
+			_, _ = w.Write([]byte(emptyVectorResponse))
+		default:
+			_, _ = w.Write([]byte(`{"status":"success","data":[]}`))
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "tenant-a")
+	now := time.Now()
+
+	_, err := c.QueryFor("tenant-b", "series_1", now)
+	require.NoError(t, err)
+	_, err = c.QueryRangeFor("tenant-b", "series_1", now.Add(-time.Hour), now, time.Minute)
+	require.NoError(t, err)
+	_, err = c.LabelValuesFor("tenant-b", "job")
+	require.NoError(t, err)
+	_, err = c.LabelNamesFor("tenant-b")
+	require.NoError(t, err)
+	_, err = c.SeriesFor("tenant-b", []string{"series_1"}, now.Add(-time.Hour), now)
+	require.NoError(t, err)
+
+	// The override should apply to the single request only.
+	_, err = c.Query("series_1", now)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"tenant-b", "tenant-b", "tenant-b", "tenant-b", "tenant-b", "tenant-a"}, orgIDs)
+
+	_, err = c.QueryFor("", "series_1", now)
+	require.Error(t, err)
+}
+
+func TestClient_PushTimed(t *testing.T) {
+	const delay = 50 * time.Millisecond
+
+	distributor := newFakeDistributor(nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		distributor.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	duration, res, err := c.PushTimed([]prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.GreaterOrEqual(t, int64(duration), int64(delay))
+	assert.Less(t, int64(duration), int64(delay+time.Second))
+}
+
+func TestClient_PushCounter(t *testing.T) {
+	db := teststorage.New(t)
+	defer db.Close()
+
+	engine := promql.NewEngine(promql.EngineOpts{
+		Logger:     util.Logger,
+		MaxSamples: 1e6,
+		Timeout:    time.Minute,
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/prom/push", newFakeDistributor(func(req *prompb.WriteRequest) {
+		app := db.Appender()
+		for _, series := range req.Timeseries {
+			lbls := make(labels.Labels, 0, len(series.Labels))
+			for _, l := range series.Labels {
+				lbls = append(lbls, labels.Label{Name: l.Name, Value: l.Value})
+			}
+			for _, s := range series.Samples {
+				_, err := app.Add(lbls, s.Timestamp, s.Value)
+				require.NoError(t, err)
+			}
+		}
+		require.NoError(t, app.Commit())
+	}))
+	mux.HandleFunc("/api/prom/api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		queryTime, err := strconv.ParseFloat(r.Form.Get("time"), 64)
+		require.NoError(t, err)
+
+		q, err := engine.NewInstantQuery(db, r.Form.Get("query"), time.Unix(0, int64(queryTime*1e9)))
+		require.NoError(t, err)
+		defer q.Close()
+
+		res := q.Exec(r.Context())
+		require.NoError(t, res.Err)
+
+		data, err := json.Marshal(res.Value)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"` + string(res.Value.Type()) + `","result":` + string(data) + `}}`))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	res, err := c.PushCounter("requests_total", map[string]string{"job": "test"}, []CounterPoint{
+		{Ts: start, V: 0},
+		{Ts: start.Add(30 * time.Second), V: 30},
+		{Ts: start.Add(60 * time.Second), V: 60},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	value, err := c.Query("rate(requests_total[1m])", start.Add(60*time.Second))
+	require.NoError(t, err)
+	require.Equal(t, model.ValVector, value.Type())
+	require.Len(t, value.(model.Vector), 1)
+	assert.Equal(t, model.Metric{"job": "test"}, value.(model.Vector)[0].Metric)
+	assert.InDelta(t, 1, float64(value.(model.Vector)[0].Value), 1e-9)
+
+	// Decreasing values and non increasing timestamps should be rejected.
+	_, err = c.PushCounter("requests_total", nil, []CounterPoint{
+		{Ts: start, V: 10},
+		{Ts: start.Add(time.Second), V: 5},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "decreases from 10 to 5")
+
+	_, err = c.PushCounter("requests_total", nil, []CounterPoint{
+		{Ts: start, V: 1},
+		{Ts: start, V: 2},
+	})
+	require.Error(t, err)
+
+	_, err = c.PushCounter("requests_total", nil, nil)
+	require.Error(t, err)
+}
+
+func TestClient_WithAPIPrefix(t *testing.T) {
+	var pushed []prompb.TimeSeries
+
+	mux := http.NewServeMux()
+	mux.Handle("/prometheus/push", newFakeDistributor(func(req *prompb.WriteRequest) {
+		pushed = append(pushed, req.Timeseries...)
+	}))
+	mux.HandleFunc("/prometheus/api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	addr := strings.TrimPrefix(server.URL, "http://")
+	c, err := NewClient(addr, addr, addr, addr, "user-1", WithAPIPrefix("/prometheus/"))
+	require.NoError(t, err)
+
+	res, err := c.Push([]prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Len(t, pushed, 1)
+
+	res, _, err = c.QueryRaw("series_1", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	_, err = c.Query("series_1", time.Now())
+	require.NoError(t, err)
+
+	// The default prefix should not be mounted.
+	c = newTestClient(t, server, "user-1")
+
+	res, _, err = c.QueryRaw("series_1", time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
+
+func TestClient_RawQueryCompression(t *testing.T) {
+	var acceptEncodings []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncodings = append(acceptEncodings, r.Header.Get("Accept-Encoding"))
+
+		w.Header().Set("Content-Type", "application/json")
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			writeMatrixResponse(w, 10, 10)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		writeMatrixResponse(gz, 10, 10)
+		require.NoError(t, gz.Close())
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+
+	// The response should be requested compressed, and transparently decompressed.
+	res, body, err := c.QueryRangeRaw("series_1", now.Add(-time.Hour), now, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+
+	value, err := DecodeQueryResponse(res, body)
+	require.NoError(t, err)
+	assert.Len(t, value.(model.Matrix), 10)
+
+	res, body, err = c.LabelNamesRaw(nil, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+	assert.True(t, json.Valid(body))
+
+	// The compressed body should be returned as is, if requested.
+	res, body, err = c.QueryRaw("series_1", now, WithCompressedBody())
+	require.NoError(t, err)
+	assert.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	require.NoError(t, err)
+	decompressed, err := ioutil.ReadAll(gz)
+	require.NoError(t, err)
+	assert.True(t, json.Valid(decompressed))
+
+	// An explicit Accept-Encoding should take precedence.
+	res, body, err = c.QueryRaw("series_1", now, WithHeader("Accept-Encoding", "identity"))
+	require.NoError(t, err)
+	assert.Empty(t, res.Header.Get("Content-Encoding"))
+	assert.True(t, json.Valid(body))
+
+	assert.Equal(t, []string{"gzip", "gzip", "gzip", "identity"}, acceptEncodings)
+}
+
+func TestClient_WithMaxResponseSize(t *testing.T) {
+	const responseSize = 1 << 20
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(bytes.Repeat([]byte(" "), responseSize-len(emptyVectorResponse)))
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+
+	// No limit by default.
+	_, body, err := c.QueryRaw("series_1", now)
+	require.NoError(t, err)
+	assert.Len(t, body, responseSize)
+
+	_, body, err = c.QueryRaw("series_1", now, WithMaxResponseSize(responseSize))
+	require.NoError(t, err)
+	assert.Len(t, body, responseSize)
+
+	_, _, err = c.QueryRaw("series_1", now, WithMaxResponseSize(1024))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeds the max size of 1024 bytes")
+
+	_, _, err = c.LabelNamesRaw(nil, time.Time{}, time.Time{}, WithMaxResponseSize(1024))
+	require.Error(t, err)
+}
+
+func TestClient_PushAndQuery(t *testing.T) {
+	const visibilityDelay = 200 * time.Millisecond
+
+	var (
+		mtx      sync.Mutex
+		pushedAt time.Time
+		pushed   []prompb.TimeSeries
+	)
+
+	// The pushed samples become visible to queries after a delay.
+	mux := http.NewServeMux()
+	mux.Handle("/api/prom/push", newFakeDistributor(func(req *prompb.WriteRequest) {
+		mtx.Lock()
+		defer mtx.Unlock()
+		pushedAt = time.Now()
+		pushed = append(pushed, req.Timeseries...)
+	}))
+	mux.HandleFunc("/api/prom/api/v1/query", func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		result := model.Vector{}
+		if time.Since(pushedAt) >= visibilityDelay {
+			for _, series := range pushed {
+				metric := model.Metric{}
+				for _, l := range series.Labels {
+					metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+				}
+				result = append(result, &model.Sample{Metric: metric, Value: model.SampleValue(series.Samples[0].Value), Timestamp: model.Time(series.Samples[0].Timestamp)})
+			}
+		}
+
+		data, err := json.Marshal(result)
+		require.NoError(t, err)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":` + string(data) + `}}`))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	start := time.Now()
+	require.NoError(t, c.PushAndQuery("series_1", map[string]string{"job": "test"}, 42, time.Now(), 5*time.Second))
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(visibilityDelay))
+
+	// The timeout should be respected if the value never shows up.
+	start = time.Now()
+	err := c.PushAndQuery("series_1", map[string]string{"job": "test"}, 43, time.Now(), 100*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected 1 series, got 0")
+	assert.Less(t, int64(time.Since(start)), int64(visibilityDelay))
+
+	require.Error(t, c.PushAndQuery("series-1", nil, 1, time.Now(), time.Second))
+
+	// The timeout should apply to the push too, not only to the polling.
+	slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The request context is only canceled once the body has been read.
+		_, _ = ioutil.ReadAll(r.Body)
+		<-r.Context().Done()
+	}))
+	defer slowServer.Close()
+
+	slow := newTestClient(t, slowServer, "user-1")
+	start = time.Now()
+	require.Error(t, slow.PushAndQuery("series_1", nil, 1, time.Now(), 100*time.Millisecond))
+	assert.Less(t, int64(time.Since(start)), int64(slow.timeout))
+}
+
+func TestClient_QueryNow(t *testing.T) {
+	var timeParams [][]string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		timeParams = append(timeParams, r.Form["time"])
+
+		// Like Prometheus, evaluate the query at the current time if not specified.
+		evalTime := time.Now()
+		if r.Form.Get("time") != "" {
+			seconds, err := strconv.ParseFloat(r.Form.Get("time"), 64)
+			require.NoError(t, err)
+			evalTime = time.Unix(0, int64(seconds*1e9))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"scalar","result":[%s,"1"]}}`, formatTime(evalTime))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	value, err := c.QueryNow("1")
+	require.NoError(t, err)
+	require.Equal(t, model.ValScalar, value.Type())
+	assert.WithinDuration(t, time.Now(), value.(*model.Scalar).Timestamp.Time(), 5*time.Second)
+
+	res, body, err := c.QueryNowRaw("1")
+	require.NoError(t, err)
+	value, err = DecodeQueryResponse(res, body)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now(), value.(*model.Scalar).Timestamp.Time(), 5*time.Second)
+
+	// An explicit time should be sent as is.
+	past := time.Now().Add(-time.Hour)
+	value, err = c.Query("1", past)
+	require.NoError(t, err)
+	assert.WithinDuration(t, past, value.(*model.Scalar).Timestamp.Time(), time.Millisecond)
+
+	require.Len(t, timeParams, 3)
+	assert.Empty(t, timeParams[0])
+	assert.Empty(t, timeParams[1])
+	assert.Len(t, timeParams[2], 1)
+}
+
+func TestClient_QueryWithCacheHeaders(t *testing.T) {
+	calls := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+
+		w.Header().Set("Content-Type", "application/json")
+		if calls == 1 {
+			w.Header().Set("X-Cache-Status", "miss")
+		} else {
+			w.Header().Set("X-Cache-Status", "hit")
+		}
+		_, _ = w.Write([]byte(emptyVectorResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	now := time.Now()
+
+	value, header, err := c.QueryWithCacheHeaders("series_1", now)
+	require.NoError(t, err)
+	assert.Equal(t, model.ValVector, value.Type())
+	assert.Equal(t, "miss", header.Get("X-Cache-Status"))
+
+	_, header, err = c.QueryWithCacheHeaders("series_1", now)
+	require.NoError(t, err)
+	assert.Equal(t, "hit", header.Get("X-Cache-Status"))
+}
+
+func TestClient_WithoutRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", http.RedirectHandler("/other/metrics", http.StatusFound))
+	mux.HandleFunc("/other/metrics", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("series_1 1\n"))
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	addr := strings.TrimPrefix(server.URL, "http://")
+
+	// Redirects should be followed by default.
+	c := newTestClient(t, server, "user-1")
+	families, err := c.GetMetrics(addr)
+	require.NoError(t, err)
+	assert.Contains(t, families, "series_1")
+
+	c, err = NewClient(addr, addr, addr, addr, "user-1", WithoutRedirects())
+	require.NoError(t, err)
+
+	_, err = c.GetMetrics(addr)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 302")
+
+	res, _, err := c.doRequest(http.MethodGet, server.URL+"/metrics", nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+	assert.Equal(t, "/other/metrics", res.Header.Get("Location"))
+}
+
+func TestClient_GetAlertmanagerConfigWithTemplates(t *testing.T) {
+	var stored []byte
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/alerts", r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		switch r.Method {
+		case http.MethodPost:
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			stored = body
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			if stored == nil {
+				http.Error(w, "alertmanager config not found", http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(stored)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	ctx := context.Background()
+
+	_, _, err := c.GetAlertmanagerConfigWithTemplates(ctx)
+	assert.Equal(t, ErrNotFound, err)
+
+	const (
+		amConfig = "route:\n  receiver: dummy\nreceivers:\n  - name: dummy\n"
+		template = `{{ define "email.subject" }}[{{ .Status }}] {{ .GroupLabels.alertname }}{{ end }}`
+	)
+	require.NoError(t, c.SetAlertmanagerConfig(ctx, amConfig, map[string]string{"email.tmpl": template}))
+
+	config, templates, err := c.GetAlertmanagerConfigWithTemplates(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, amConfig, config)
+	assert.Equal(t, map[string]string{"email.tmpl": template}, templates)
+}
+
+func TestClient_DeleteRuleNamespace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		switch r.URL.EscapedPath() {
+		case "/api/prom/rules/test%2Fnamespace":
+			w.WriteHeader(http.StatusAccepted)
+		case "/api/prom/rules/missing":
+			http.Error(w, "no rule groups found", http.StatusNotFound)
+		case "/api/prom/rules/unsupported":
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		default:
+			http.Error(w, "unable to delete rule namespace", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	require.NoError(t, c.DeleteRuleNamespace("test/namespace"))
+	assert.Equal(t, ErrNotFound, c.DeleteRuleNamespace("missing"))
+
+	err := c.DeleteRuleNamespace("unsupported")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Contains(t, err.Error(), "doesn't support deleting a rule namespace")
+
+	err = c.DeleteRuleNamespace("failing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 500")
+	assert.Contains(t, err.Error(), "unable to delete rule namespace")
+}
+
+func TestClient_GetRuleGroup(t *testing.T) {
+	// The fake ruler stores the uploaded rule groups by their escaped path.
+	stored := map[string][]byte{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		switch r.Method {
+		case http.MethodPost:
+			rg := rulefmt.RuleGroup{}
+			require.NoError(t, yaml.Unmarshal(body, &rg))
+			stored[r.URL.EscapedPath()+"/"+url.PathEscape(rg.Name)] = body
+			w.WriteHeader(http.StatusAccepted)
+		case http.MethodGet:
+			data, ok := stored[r.URL.EscapedPath()]
+			if !ok {
+				http.Error(w, "group does not exist", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/yaml")
+			_, _ = w.Write(data)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	expected := RuleGroup{
+		Name:     "my group/with slash",
+		Interval: model.Duration(30 * time.Second),
+		Rules: []Rule{
+			{Record: "job:up:sum", Expr: "sum by (job) (up)"},
+			{
+				Alert:       "InstanceDown",
+				Expr:        "up == 0",
+				For:         model.Duration(time.Minute),
+				Labels:      map[string]string{"severity": "page"},
+				Annotations: map[string]string{"summary": "instance {{ $labels.instance }} is down"},
+			},
+		},
+	}
+
+	require.NoError(t, c.SetRuleGroup(expected, "my namespace/with slash"))
+
+	actual, err := c.GetRuleGroup("my namespace/with slash", "my group/with slash")
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	_, err = c.GetRuleGroup("my namespace/with slash", "missing")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClient_GetHATrackerStatus(t *testing.T) {
+	const statusResponse = `{"elected":[
+		{"userID":"user-1","cluster":"cluster-a","replica":"replica-1","electedAt":"2020-08-01T10:00:00Z","updateDuration":10000000000,"failoverDuration":25000000000},
+		{"userID":"user-1","cluster":"cluster-b","replica":"replica-2","electedAt":"2020-08-01T10:00:01Z","updateDuration":11000000000,"failoverDuration":26000000000}
+	],"now":"2020-08-01T10:00:05Z"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ha-tracker", r.URL.Path)
+
+		if r.Header.Get("Accept") != "application/json" {
+			_, _ = w.Write([]byte("<!DOCTYPE html><html></html>"))
+			return
+		}
+		_, _ = w.Write([]byte(statusResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	entries, err := c.GetHATrackerStatus(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, HATrackerEntry{
+		UserID:           "user-1",
+		Cluster:          "cluster-a",
+		Replica:          "replica-1",
+		ElectedAt:        time.Date(2020, 8, 1, 10, 0, 0, 0, time.UTC),
+		UpdateDuration:   10 * time.Second,
+		FailoverDuration: 25 * time.Second,
+	}, entries[0])
+	assert.Equal(t, "replica-2", entries[1].Replica)
+
+	notFoundServer := httptest.NewServer(http.NotFoundHandler())
+	defer notFoundServer.Close()
+
+	_, err = c.GetHATrackerStatus(strings.TrimPrefix(notFoundServer.URL, "http://"))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestClient_SetRuleGroup(t *testing.T) {
+	const maxRulesPerGroup = 2
+
+	// The fake ruler validates the uploaded rule groups like the real one, and
+	// enforces a max number of rules per group.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "/api/prom/rules/test", r.URL.Path)
+		assert.Equal(t, "application/yaml", r.Header.Get("Content-Type"))
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+
+		rg := rulefmt.RuleGroup{}
+		require.NoError(t, yaml.Unmarshal(body, &rg))
+
+		if errs := ruler.ValidateRuleGroup(rg); len(errs) > 0 {
+			http.Error(w, errs[0].Error(), http.StatusBadRequest)
+			return
+		}
+		if len(rg.Rules) > maxRulesPerGroup {
+			http.Error(w, fmt.Sprintf("per-user rules per rule group limit (limit: %d actual: %d) exceeded", maxRulesPerGroup, len(rg.Rules)), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	ruleGroup := func(exprs ...string) RuleGroup {
+		rg := RuleGroup{Name: "group"}
+		for i, expr := range exprs {
+			rg.Rules = append(rg.Rules, Rule{Record: fmt.Sprintf("rule_%d", i), Expr: expr})
+		}
+		return rg
+	}
+
+	require.NoError(t, c.SetRuleGroup(ruleGroup("up", "sum(up)"), "test"))
+
+	var validationErr *RuleValidationError
+
+	err := c.SetRuleGroup(ruleGroup("up", "sum(up"), "test")
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, "test", validationErr.Namespace)
+	assert.Equal(t, "group", validationErr.Group)
+	assert.Equal(t, 1, validationErr.RuleIndex)
+	assert.Equal(t, "rule_1", validationErr.RuleName)
+	assert.Contains(t, validationErr.Message, "parse error")
+
+	err = c.SetRuleGroup(ruleGroup("up", "up", "up"), "test")
+	require.True(t, errors.As(err, &validationErr))
+	assert.Equal(t, &RuleValidationError{
+		Namespace: "test",
+		Group:     "group",
+		RuleIndex: -1,
+		Message:   "per-user rules per rule group limit (limit: 2 actual: 3) exceeded",
+	}, validationErr)
+
+	notFoundServer := httptest.NewServer(http.NotFoundHandler())
+	defer notFoundServer.Close()
+
+	assert.Equal(t, ErrNotFound, newTestClient(t, notFoundServer, "user-1").SetRuleGroup(ruleGroup("up"), "test"))
+}
+
+func TestClient_PushUncompressed(t *testing.T) {
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}}
+
+	var received []*prompb.WriteRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+
+		data, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := &prompb.WriteRequest{}
+		require.NoError(t, proto.Unmarshal(data, req))
+		received = append(received, req)
+	}))
+	defer server.Close()
+
+	res, err := newTestClient(t, server, "user-1").PushUncompressed(series)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	require.Len(t, received, 1)
+	assert.Equal(t, series, received[0].Timeseries)
+
+	// The distributor push handler expects snappy compressed requests, so it
+	// should reject the uncompressed one.
+	pushed := false
+	pushServer := httptest.NewServer(push.Handler(distributor.Config{MaxRecvMsgSize: 100 << 20}, func(context.Context, *client.WriteRequest) (*client.WriteResponse, error) {
+		pushed = true
+		return &client.WriteResponse{}, nil
+	}))
+	defer pushServer.Close()
+
+	c := newTestClient(t, pushServer, "user-1")
+
+	res, err = c.PushUncompressed(series)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusBadRequest, res.StatusCode)
+	assert.False(t, pushed)
+
+	res, err = c.Push(series)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, pushed)
+}
+
+func TestClient_PushHA(t *testing.T) {
+	for _, custom := range []bool{false, true} {
+		clusterLabel, replicaLabel := DefaultHAClusterLabel, DefaultHAReplicaLabel
+		var opts []ClientOption
+		if custom {
+			clusterLabel, replicaLabel = "__cluster__", "__ha_replica__"
+			opts = append(opts, WithHALabels(clusterLabel, replicaLabel))
+		}
+
+		var (
+			elected = map[string]string{}
+			stored  []string
+		)
+
+		// The fake distributor elects the first replica pushing for each cluster,
+		// and drops the samples of the other replicas like the HA tracker.
+		distributor := newFakeDistributor(func(req *prompb.WriteRequest) {
+			for _, ts := range req.Timeseries {
+				metric := model.Metric{}
+				for _, l := range ts.Labels {
+					metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+				}
+
+				cluster, replica := string(metric[model.LabelName(clusterLabel)]), string(metric[model.LabelName(replicaLabel)])
+				if _, ok := elected[cluster]; !ok {
+					elected[cluster] = replica
+				}
+				if elected[cluster] != replica {
+					continue
+				}
+
+				delete(metric, model.LabelName(replicaLabel))
+				stored = append(stored, metric.String())
+			}
+		})
+
+		server := httptest.NewServer(distributor)
+		addr := strings.TrimPrefix(server.URL, "http://")
+
+		c, err := NewClient(addr, addr, addr, addr, "user-1", opts...)
+		require.NoError(t, err)
+
+		series := []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}, {Name: replicaLabel, Value: "overridden"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+		}}
+
+		for _, replica := range []string{"replica-1", "replica-2"} {
+			res, err := c.PushHA("cluster-a", replica, series)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+		server.Close()
+
+		assert.Equal(t, map[string]string{"cluster-a": "replica-1"}, elected)
+		assert.Equal(t, []string{fmt.Sprintf(`series_1{%s="cluster-a"}`, clusterLabel)}, stored)
+
+		// The input series should not be modified.
+		assert.Equal(t, []prompb.Label{{Name: "__name__", Value: "series_1"}, {Name: replicaLabel, Value: "overridden"}}, series[0].Labels)
+	}
+}
+
+func TestClient_DeleteRuleGroup(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodDelete, r.Method)
+		assert.Empty(t, r.Header.Get("Content-Type"))
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		switch r.URL.EscapedPath() {
+		case "/api/prom/rules/test/my%20group":
+			w.WriteHeader(http.StatusAccepted)
+		case "/api/prom/rules/test/missing":
+			http.Error(w, "group does not exist", http.StatusNotFound)
+		default:
+			http.Error(w, "unable to delete rule group", http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	require.NoError(t, c.DeleteRuleGroup("test", "my group"))
+	assert.Equal(t, ErrNotFound, c.DeleteRuleGroup("test", "missing"))
+
+	err := c.DeleteRuleGroup("test", "failing")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "status 500")
+	assert.Contains(t, err.Error(), "unable to delete rule group")
+}
+
+func TestClient_PushExpectingError(t *testing.T) {
+	// The fake distributor rejects samples older than the latest one of the
+	// same series, like the ingesters.
+	latest := map[string]int64{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		compressed, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		data, err := snappy.Decode(nil, compressed)
+		require.NoError(t, err)
+		req := &prompb.WriteRequest{}
+		require.NoError(t, proto.Unmarshal(data, req))
+
+		for _, ts := range req.Timeseries {
+			key := fmt.Sprint(ts.Labels)
+			for _, s := range ts.Samples {
+				if last, ok := latest[key]; ok && s.Timestamp < last {
+					http.Error(w, fmt.Sprintf("sample timestamp out of order; last timestamp: %d, incoming timestamp: %d", last, s.Timestamp), http.StatusBadRequest)
+					return
+				}
+				latest[key] = s.Timestamp
+			}
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	series := func(ts int64) []prompb.TimeSeries {
+		return []prompb.TimeSeries{{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: ts}},
+		}}
+	}
+
+	// The newer sample is accepted, so it doesn't fail with the expected status.
+	err := c.PushExpectingError(series(2000), http.StatusBadRequest)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected to fail with status 400, but got status 200")
+
+	require.NoError(t, c.PushExpectingError(series(1000), http.StatusBadRequest))
+
+	err = c.PushExpectingError(series(1000), http.StatusTooManyRequests)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "got status 400")
+	assert.Contains(t, err.Error(), "sample timestamp out of order")
+}
+
+func TestClient_ListAlertmanagerTenants(t *testing.T) {
+	const configsResponse = `user-2:
+  template_files: {}
+  alertmanager_config: |
+    route:
+      receiver: dummy
+    receivers:
+    - name: dummy
+user-1:
+  template_files:
+    default.tmpl: '{{ define "test" }}test{{ end }}'
+  alertmanager_config: |
+    route:
+      receiver: dummy
+    receivers:
+    - name: dummy
+`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/multitenant_alertmanager/configs", r.URL.Path)
+
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write([]byte(configsResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	tenants, err := c.ListAlertmanagerTenants(strings.TrimPrefix(server.URL, "http://"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"user-1", "user-2"}, tenants)
+
+	notFoundServer := httptest.NewServer(http.NotFoundHandler())
+	defer notFoundServer.Close()
+
+	_, err = c.ListAlertmanagerTenants(strings.TrimPrefix(notFoundServer.URL, "http://"))
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Contains(t, err.Error(), "doesn't expose the configs listing")
+}
+
+func TestClient_ListRuleNamespaces(t *testing.T) {
+	const rulesResponse = `namespace-b:
+- name: group-1
+  rules:
+  - record: rule_1
+    expr: up
+namespace-a:
+- name: group-1
+  rules:
+  - record: rule_1
+    expr: up
+`
+
+	response := rulesResponse
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/rules", r.URL.Path)
+		assert.Equal(t, "user-1", r.Header.Get("X-Scope-OrgID"))
+
+		if response == "" {
+			http.Error(w, ruler.ErrNoRuleGroups.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/yaml")
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	namespaces, err := c.ListRuleNamespaces()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"namespace-a", "namespace-b"}, namespaces)
+
+	// A tenant without rule groups should have no namespaces.
+	response = ""
+	namespaces, err = c.ListRuleNamespaces()
+	require.NoError(t, err)
+	assert.Empty(t, namespaces)
+
+	// The ruler API being disabled should be reported.
+	notFoundServer := httptest.NewServer(http.NotFoundHandler())
+	defer notFoundServer.Close()
+
+	_, err = newTestClient(t, notFoundServer, "user-1").ListRuleNamespaces()
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClient_QuerySlow(t *testing.T) {
+	server := newFakeQuerier(50 * time.Millisecond)
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	res, body, err := c.QuerySlow("1", time.Now(), 20*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Contains(t, string(body), `"resultType":"scalar"`)
+
+	// A query faster than the min duration should be reported, along with its response.
+	res, _, err = c.QuerySlow("1", time.Now(), time.Minute)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "faster than the min duration 1m0s")
+	require.NotNil(t, res)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestClient_WaitForRuleActive(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		polls int
+	)
+
+	// The rule is only loaded at the 2nd poll, and starts firing at the 4th one.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/api/v1/rules", r.URL.Path)
+
+		mtx.Lock()
+		polls++
+		n := polls
+		mtx.Unlock()
+
+		rules := ""
+		switch {
+		case n >= 4:
+			rules = `{"state":"firing","name":"SeriesHigh","query":"series_1 > 1","health":"ok","type":"alerting","alerts":[{"state":"firing","value":"2"}]}`
+		case n >= 2:
+			rules = `{"state":"inactive","name":"SeriesHigh","query":"series_1 > 1","health":"ok","type":"alerting"}`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"groups":[{"name":"group-1","file":"namespace-1","rules":[` + rules + `]}]}}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rule, err := c.WaitForRuleActive(ctx, "namespace-1", "group-1", "SeriesHigh", "ok", WithPollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, "inactive", rule.State)
+
+	rule, err = c.WaitForRuleActive(ctx, "namespace-1", "group-1", "SeriesHigh", "pending", WithPollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, "firing", rule.State)
+	assert.Len(t, rule.Alerts, 1)
+
+	// The last observed state should be reported on timeout.
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+
+	_, err = c.WaitForRuleActive(shortCtx, "namespace-1", "group-1", "SeriesHigh", "err", WithPollInterval(10*time.Millisecond))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `last health: "ok", last state: "firing"`)
+
+	missingCtx, missingCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer missingCancel()
+
+	_, err = c.WaitForRuleActive(missingCtx, "namespace-2", "group-1", "SeriesHigh", "ok", WithPollInterval(10*time.Millisecond))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the rule was not found")
+}
+
+func TestClient_GetRingInstance(t *testing.T) {
+	const ringResponse = `{"shards":[
+		{"id":"ingester-1","state":"ACTIVE","address":"10.0.0.1:9095","timestamp":"2020-08-01 10:00:00 +0000 UTC","zone":"zone-a","tokens":[10,30]},
+		{"id":"ingester-2","state":"LEAVING","address":"10.0.0.2:9095","timestamp":"2020-08-01 10:00:00 +0000 UTC","zone":"zone-b","tokens":[20]}
+	],"now":"2020-08-01T10:00:05Z"}`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ingester/ring", r.URL.Path)
+		_, _ = w.Write([]byte(ringResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	instance, err := c.GetRingInstance(address, "/ingester/ring", "ingester-2")
+	require.NoError(t, err)
+	assert.Equal(t, &RingInstance{ID: "ingester-2", State: "LEAVING", Address: "10.0.0.2:9095", Timestamp: "2020-08-01 10:00:00 +0000 UTC", Zone: "zone-b", Tokens: []uint32{20}}, instance)
+
+	_, err = c.GetRingInstance(address, "/ingester/ring", "ingester-3")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestClient_WaitForRulerRing(t *testing.T) {
+	var (
+		mtx   sync.Mutex
+		polls int
+	)
+
+	// The 2nd ruler joins the ring at the 2nd poll, and becomes ACTIVE at the 3rd one.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/ruler/ring", r.URL.Path)
+
+		mtx.Lock()
+		polls++
+		n := polls
+		mtx.Unlock()
+
+		instances := `{"id":"ruler-1","state":"ACTIVE","address":"10.0.0.1:9095","tokens":[10,30]}`
+		switch {
+		case n >= 3:
+			instances += `,{"id":"ruler-2","state":"ACTIVE","address":"10.0.0.2:9095","tokens":[20]}`
+		case n >= 2:
+			instances += `,{"id":"ruler-2","state":"JOINING","address":"10.0.0.2:9095","tokens":[]}`
+		}
+		_, _ = w.Write([]byte(`{"shards":[` + instances + `]}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	instances, err := c.WaitForRulerRing(ctx, address, 2, WithPollInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.Equal(t, "ruler-2", instances[1].ID)
+	assert.Len(t, instances[1].Tokens, 1)
+
+	// The last observed instances should be reported on timeout.
+	shortCtx, shortCancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer shortCancel()
+
+	_, err = c.WaitForRulerRing(shortCtx, address, 3, WithPollInterval(10*time.Millisecond))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "last instances: [ruler-1=ACTIVE, ruler-2=ACTIVE]")
+}
+
+func TestClient_QueryRawFormat(t *testing.T) {
+	protoResponse := &queryrange.PrometheusResponse{
+		Status: "success",
+		Data: queryrange.PrometheusData{
+			ResultType: "vector",
+			Result: []queryrange.SampleStream{{
+				Labels:  []client.LabelAdapter{{Name: "__name__", Value: "series_1"}},
+				Samples: []client.Sample{{TimestampMs: 1000, Value: 2}},
+			}},
+		},
+	}
+	const jsonResponse = `{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"series_1"},"value":[1,"2"]}]}}`
+
+	honorAccept := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if honorAccept && r.Header.Get("Accept") == ContentTypeProtobuf {
+			data, err := protoResponse.Marshal()
+			require.NoError(t, err)
+
+			w.Header().Set("Content-Type", ContentTypeProtobuf)
+			_, _ = w.Write(data)
+			return
+		}
+
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		_, _ = w.Write([]byte(jsonResponse))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	ts := time.Unix(1, 0)
+	expected := model.Vector{{Metric: model.Metric{"__name__": "series_1"}, Value: 2, Timestamp: 1000}}
+
+	for _, contentType := range []string{ContentTypeJSON, ContentTypeProtobuf} {
+		res, body, err := c.QueryRawFormat("series_1", ts, contentType)
+		require.NoError(t, err)
+		assert.Equal(t, contentType, res.Header.Get("Content-Type"))
+
+		value, err := DecodeQueryResponse(res, body)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+
+	// A server ignoring the Accept header should be reported.
+	honorAccept = false
+
+	res, body, err := c.QueryRawFormat("series_1", ts, ContentTypeProtobuf)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `the response has content type "application/json"`)
+	assert.Equal(t, jsonResponse, string(body))
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+}
+
+func TestClient_FlushQueryCache(t *testing.T) {
+	var requests []string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("X-Scope-OrgID"))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	require.NoError(t, newTestClient(t, server, "user-1").FlushQueryCache())
+	assert.Equal(t, []string{"POST /frontend/cache/flush user-1"}, requests)
+
+	// A query frontend not exposing the endpoint should be reported.
+	notFoundServer := httptest.NewServer(http.NotFoundHandler())
+	defer notFoundServer.Close()
+
+	err := newTestClient(t, notFoundServer, "user-1").FlushQueryCache()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Contains(t, err.Error(), "doesn't support flushing the query cache")
+}
+
+func TestClient_PushExpectRateLimited(t *testing.T) {
+	status, retryAfter := http.StatusOK, ""
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/prom/push", r.URL.Path)
+
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		if status/100 != 2 {
+			http.Error(w, "ingestion rate limit (10) exceeded while adding 1 samples", status)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "series_1"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1}},
+	}}
+
+	limited, err := c.PushExpectRateLimited(series)
+	require.NoError(t, err)
+	assert.False(t, limited)
+
+	status, retryAfter = http.StatusTooManyRequests, "5"
+	limited, err = c.PushExpectRateLimited(series)
+	require.NoError(t, err)
+	assert.True(t, limited)
+
+	// The suggested delay is exposed through the response of Push.
+	res, err := c.Push(series)
+	require.NoError(t, err)
+	assert.Equal(t, 5*time.Second, RetryAfter(res))
+
+	status = http.StatusBadRequest
+	limited, err = c.PushExpectRateLimited(series)
+	require.Error(t, err)
+	assert.False(t, limited)
+	assert.Contains(t, err.Error(), "status 400")
+}
+
+func TestRetryAfter(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected time.Duration
+	}{
+		{value: "", expected: 0},
+		{value: "5", expected: 5 * time.Second},
+		{value: "-1", expected: 0},
+		{value: "soon", expected: 0},
+		{value: time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat), expected: 0},
+	} {
+		res := &http.Response{Header: http.Header{}}
+		res.Header.Set("Retry-After", tc.value)
+		assert.Equal(t, tc.expected, RetryAfter(res), tc.value)
+	}
+
+	res := &http.Response{Header: http.Header{}}
+	res.Header.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	assert.InDelta(t, time.Minute, RetryAfter(res), float64(2*time.Second))
+}
@@ -0,0 +1,574 @@
+package e2ecortex
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// CompareValues compares two query results, allowing each sample value to differ
+// by at most tolerance (absolute). Series are matched by their labels, regardless
+// of their ordering. It returns the max delta found across the matched samples,
+// and an error describing the first difference found, if any.
+func CompareValues(expected, actual model.Value, tolerance float64) (float64, error) {
+	if expected.Type() != actual.Type() {
+		return 0, fmt.Errorf("expected result type %s, got %s", expected.Type(), actual.Type())
+	}
+
+	switch e := expected.(type) {
+	case *model.Scalar:
+		a := actual.(*model.Scalar)
+		if e.Timestamp != a.Timestamp {
+			return 0, fmt.Errorf("expected scalar at %v, got %v", e.Timestamp, a.Timestamp)
+		}
+		return compareSampleValues(e.Value, a.Value, tolerance)
+
+	case *model.String:
+		a := actual.(*model.String)
+		if e.Value != a.Value || e.Timestamp != a.Timestamp {
+			return 0, fmt.Errorf("expected string %s, got %s", e, a)
+		}
+		return 0, nil
+
+	case model.Vector:
+		return compareVectors(e, actual.(model.Vector), tolerance)
+
+	case model.Matrix:
+		return compareMatrices(e, actual.(model.Matrix), tolerance)
+
+	default:
+		return 0, fmt.Errorf("unsupported result type %s", expected.Type())
+	}
+}
+
+func compareVectors(expected, actual model.Vector, tolerance float64) (float64, error) {
+	if len(expected) != len(actual) {
+		return 0, fmt.Errorf("expected %d series, got %d", len(expected), len(actual))
+	}
+
+	actualByFingerprint := make(map[model.Fingerprint]*model.Sample, len(actual))
+	for _, s := range actual {
+		actualByFingerprint[s.Metric.Fingerprint()] = s
+	}
+
+	maxDelta := 0.0
+	for _, e := range expected {
+		a, ok := actualByFingerprint[e.Metric.Fingerprint()]
+		if !ok {
+			return maxDelta, fmt.Errorf("missing series %s", e.Metric)
+		}
+
+		if e.Timestamp != a.Timestamp {
+			return maxDelta, fmt.Errorf("series %s: expected sample at %v, got %v", e.Metric, e.Timestamp, a.Timestamp)
+		}
+
+		delta, err := compareSampleValues(e.Value, a.Value, tolerance)
+		maxDelta = math.Max(maxDelta, delta)
+		if err != nil {
+			return maxDelta, fmt.Errorf("series %s: %v", e.Metric, err)
+		}
+	}
+
+	return maxDelta, nil
+}
+
+func compareMatrices(expected, actual model.Matrix, tolerance float64) (float64, error) {
+	if len(expected) != len(actual) {
+		return 0, fmt.Errorf("expected %d series, got %d", len(expected), len(actual))
+	}
+
+	actualByFingerprint := make(map[model.Fingerprint]*model.SampleStream, len(actual))
+	for _, s := range actual {
+		actualByFingerprint[s.Metric.Fingerprint()] = s
+	}
+
+	maxDelta := 0.0
+	for _, e := range expected {
+		a, ok := actualByFingerprint[e.Metric.Fingerprint()]
+		if !ok {
+			return maxDelta, fmt.Errorf("missing series %s", e.Metric)
+		}
+
+		if len(e.Values) != len(a.Values) {
+			return maxDelta, fmt.Errorf("series %s: expected %d samples, got %d", e.Metric, len(e.Values), len(a.Values))
+		}
+
+		for i := range e.Values {
+			if e.Values[i].Timestamp != a.Values[i].Timestamp {
+				return maxDelta, fmt.Errorf("series %s: expected sample at %v, got %v", e.Metric, e.Values[i].Timestamp, a.Values[i].Timestamp)
+			}
+
+			delta, err := compareSampleValues(e.Values[i].Value, a.Values[i].Value, tolerance)
+			maxDelta = math.Max(maxDelta, delta)
+			if err != nil {
+				return maxDelta, fmt.Errorf("series %s at %v: %v", e.Metric, e.Values[i].Timestamp, err)
+			}
+		}
+	}
+
+	return maxDelta, nil
+}
+
+// compareSampleValues returns the delta between two sample values, and an
+// error if it's greater than tolerance. NaN values are only equal to each other.
+func compareSampleValues(expected, actual model.SampleValue, tolerance float64) (float64, error) {
+	e, a := float64(expected), float64(actual)
+
+	if math.IsNaN(e) || math.IsNaN(a) {
+		if math.IsNaN(e) && math.IsNaN(a) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("expected value %v, got %v", expected, actual)
+	}
+
+	// Covers infinite values too, whose delta would be NaN.
+	if e == a {
+		return 0, nil
+	}
+
+	delta := math.Abs(e - a)
+	if delta > tolerance {
+		return delta, fmt.Errorf("expected value %v, got %v (delta %v exceeds tolerance %v)", expected, actual, delta, tolerance)
+	}
+	return delta, nil
+}
+
+// QueryShardingReport is the outcome of CheckQuerySharding.
+type QueryShardingReport struct {
+	// Equal is true if the sharded and unsharded results match within the tolerance.
+	Equal bool
+
+	// MaxDelta is the max delta found between matched samples.
+	MaxDelta float64
+
+	// Diff describes the first difference found, if the results don't match.
+	Diff string
+
+	// ShardedQueries is the number of sharded queries executed by the query
+	// frontend while running the query, as tracked by its metrics. It's
+	// accurate only if no other query runs concurrently.
+	ShardedQueries float64
+}
+
+// CheckQuerySharding runs a range query both through the sharded client, which
+// is expected to point to a query frontend with query sharding enabled, and
+// through the unsharded client (e.g. pointing directly to a querier), and
+// compares the results.
+func CheckQuerySharding(sharded, unsharded *Client, query string, start, end time.Time, step time.Duration, tolerance float64) (QueryShardingReport, error) {
+	report := QueryShardingReport{}
+
+	shardedBefore, err := sharded.sumFrontendShardedQueries()
+	if err != nil {
+		return report, err
+	}
+
+	shardedResult, err := sharded.QueryRange(query, start, end, step)
+	if err != nil {
+		return report, fmt.Errorf("sharded query: %v", err)
+	}
+
+	shardedAfter, err := sharded.sumFrontendShardedQueries()
+	if err != nil {
+		return report, err
+	}
+	report.ShardedQueries = shardedAfter - shardedBefore
+
+	unshardedResult, err := unsharded.QueryRange(query, start, end, step)
+	if err != nil {
+		return report, fmt.Errorf("unsharded query: %v", err)
+	}
+
+	report.MaxDelta, err = CompareValues(unshardedResult, shardedResult, tolerance)
+	report.Equal = err == nil
+	if err != nil {
+		report.Diff = err.Error()
+	}
+
+	return report, nil
+}
+
+// sumFrontendShardedQueries returns the number of sharded queries executed so
+// far by the query frontend at the querier address, or 0 if not tracked.
+func (c *Client) sumFrontendShardedQueries() (float64, error) {
+	families, err := c.GetMetrics(c.querierAddress)
+	if err != nil {
+		return 0, err
+	}
+
+	family, ok := families["cortex_frontend_sharded_queries_total"]
+	if !ok {
+		return 0, nil
+	}
+
+	return sumMetricValues(family), nil
+}
+
+// RemoteReadReport is the outcome of CompareRemoteReadAndQueryRange.
+type RemoteReadReport struct {
+	// Equal is true if the remote read and range query results match.
+	Equal bool
+
+	// MissingSeries are the series returned by remote read, but not by the range query.
+	MissingSeries []string
+
+	// ExtraSeries are the series returned by the range query, but not by remote read.
+	ExtraSeries []string
+
+	// SampleDiffs describe the per-sample differences between matching series.
+	SampleDiffs []string
+}
+
+// CompareRemoteReadAndQueryRange fetches the series matching the input selector
+// both via remote read and via a range query, and compares them. The raw samples
+// returned by remote read are evaluated at each step the same way PromQL does:
+// the latest sample within the lookback delta is picked, and stale markers end
+// the series. The lookbackDelta must match the querier -querier.lookback-delta,
+// because it can't be overridden per query. A zero lookbackDelta defaults to
+// the PromQL default of 5m.
+func CompareRemoteReadAndQueryRange(c *Client, selector string, start, end time.Time, step, lookbackDelta time.Duration) (RemoteReadReport, error) {
+	report := RemoteReadReport{}
+
+	if lookbackDelta == 0 {
+		lookbackDelta = 5 * time.Minute
+	}
+
+	matchers, err := parser.ParseMetricSelector(selector)
+	if err != nil {
+		return report, fmt.Errorf("invalid selector %q: %v", selector, err)
+	}
+
+	raw, err := c.RemoteRead(matchers, start.Add(-lookbackDelta), end)
+	if err != nil {
+		return report, fmt.Errorf("remote read: %v", err)
+	}
+
+	result, err := c.QueryRange(selector, start, end, step)
+	if err != nil {
+		return report, fmt.Errorf("range query: %v", err)
+	}
+
+	queried, ok := result.(model.Matrix)
+	if !ok {
+		return report, fmt.Errorf("expected range query result type %s, got %s", model.ValMatrix, result.Type())
+	}
+
+	expected := map[model.Fingerprint]*model.SampleStream{}
+	for _, s := range evaluateAtSteps(raw, start, end, step, lookbackDelta) {
+		expected[s.Metric.Fingerprint()] = s
+	}
+
+	actual := map[model.Fingerprint]*model.SampleStream{}
+	for _, s := range queried {
+		actual[s.Metric.Fingerprint()] = s
+
+		if _, ok := expected[s.Metric.Fingerprint()]; !ok {
+			report.ExtraSeries = append(report.ExtraSeries, s.Metric.String())
+		}
+	}
+
+	for fp, e := range expected {
+		a, ok := actual[fp]
+		if !ok {
+			report.MissingSeries = append(report.MissingSeries, e.Metric.String())
+			continue
+		}
+
+		report.SampleDiffs = append(report.SampleDiffs, diffSampleStreams(e, a)...)
+	}
+
+	sort.Strings(report.MissingSeries)
+	sort.Strings(report.ExtraSeries)
+	sort.Strings(report.SampleDiffs)
+	report.Equal = len(report.MissingSeries) == 0 && len(report.ExtraSeries) == 0 && len(report.SampleDiffs) == 0
+
+	return report, nil
+}
+
+// evaluateAtSteps converts raw samples into the points a range query would
+// return for a plain selector. Series without points are dropped.
+func evaluateAtSteps(raw model.Matrix, start, end time.Time, step, lookbackDelta time.Duration) model.Matrix {
+	result := model.Matrix{}
+
+	for _, s := range raw {
+		evaluated := &model.SampleStream{Metric: s.Metric}
+
+		idx := 0
+		for ts := start; !ts.After(end); ts = ts.Add(step) {
+			t := model.TimeFromUnixNano(ts.UnixNano())
+
+			// Move to the latest sample not after the evaluation time.
+			for idx < len(s.Values) && !s.Values[idx].Timestamp.After(t) {
+				idx++
+			}
+			if idx == 0 {
+				continue
+			}
+
+			latest := s.Values[idx-1]
+			if !latest.Timestamp.After(t.Add(-lookbackDelta)) || value.IsStaleNaN(float64(latest.Value)) {
+				continue
+			}
+
+			evaluated.Values = append(evaluated.Values, model.SamplePair{Timestamp: t, Value: latest.Value})
+		}
+
+		if len(evaluated.Values) > 0 {
+			result = append(result, evaluated)
+		}
+	}
+
+	return result
+}
+
+func diffSampleStreams(expected, actual *model.SampleStream) []string {
+	var diffs []string
+
+	actualByTimestamp := make(map[model.Time]model.SampleValue, len(actual.Values))
+	for _, p := range actual.Values {
+		actualByTimestamp[p.Timestamp] = p.Value
+	}
+
+	for _, p := range expected.Values {
+		v, ok := actualByTimestamp[p.Timestamp]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("series %s at %v: missing sample with value %v", expected.Metric, p.Timestamp, p.Value))
+			continue
+		}
+		delete(actualByTimestamp, p.Timestamp)
+
+		if _, err := compareSampleValues(p.Value, v, 0); err != nil {
+			diffs = append(diffs, fmt.Sprintf("series %s at %v: %v", expected.Metric, p.Timestamp, err))
+		}
+	}
+
+	for ts, v := range actualByTimestamp {
+		diffs = append(diffs, fmt.Sprintf("series %s at %v: unexpected sample with value %v", expected.Metric, ts, v))
+	}
+
+	return diffs
+}
+
+// DeterminismReport is the outcome of CheckQueryDeterminism.
+type DeterminismReport struct {
+	// Deterministic is true if all runs returned byte-identical responses.
+	Deterministic bool
+
+	// FirstDiffRun is the first run whose response differs from the first
+	// run's one, or -1 if all responses are identical.
+	FirstDiffRun int
+
+	// FirstDiffOffset is the offset of the first differing byte within the
+	// response of FirstDiffRun, or -1 if all responses are identical.
+	FirstDiffOffset int
+
+	// Diff shows the responses around the first differing byte.
+	Diff string
+}
+
+// CheckQueryDeterminism runs the input query function the given number of times,
+// spreading the runs across the input clients (e.g. pointing to different querier
+// replicas) in a round robin fashion, and checks the response bodies are byte-
+// identical. If normalize is not nil, it's applied to each body before comparing
+// them, to remove fields which legitimately vary between runs. Non-2xx responses
+// are reported as errors.
+func CheckQueryDeterminism(clients []*Client, runs int, query func(c *Client) (*http.Response, []byte, error), normalize func([]byte) ([]byte, error)) (DeterminismReport, error) {
+	report := DeterminismReport{FirstDiffRun: -1, FirstDiffOffset: -1}
+
+	if len(clients) == 0 || runs < 2 {
+		return report, fmt.Errorf("at least 1 client and 2 runs are required, got %d clients and %d runs", len(clients), runs)
+	}
+
+	var first []byte
+	for run := 0; run < runs; run++ {
+		res, body, err := query(clients[run%len(clients)])
+		if err != nil {
+			return report, fmt.Errorf("run %d: %v", run, err)
+		}
+		if res.StatusCode/100 != 2 {
+			return report, fmt.Errorf("run %d: query failed with status %d and error %v", run, res.StatusCode, string(body))
+		}
+
+		if normalize != nil {
+			if body, err = normalize(body); err != nil {
+				return report, fmt.Errorf("run %d: normalizing response: %v", run, err)
+			}
+		}
+
+		if run == 0 {
+			first = body
+			continue
+		}
+
+		if offset := firstDiffOffset(first, body); offset >= 0 {
+			report.FirstDiffRun = run
+			report.FirstDiffOffset = offset
+			report.Diff = fmt.Sprintf("run 0: ...%s...\nrun %d: ...%s...", diffContext(first, offset), run, diffContext(body, offset))
+			return report, nil
+		}
+	}
+
+	report.Deterministic = true
+	return report, nil
+}
+
+// WithoutJSONFields returns a normalize function for CheckQueryDeterminism which
+// removes the input fields from all the objects in a JSON response, at any depth.
+// Object keys are sorted by the re-encoding, while array ordering is preserved.
+func WithoutJSONFields(fields ...string) func([]byte) ([]byte, error) {
+	return func(body []byte) ([]byte, error) {
+		var parsed interface{}
+		if err := json.Unmarshal(body, &parsed); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(removeJSONFields(parsed, fields))
+	}
+}
+
+func removeJSONFields(v interface{}, fields []string) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for _, f := range fields {
+			delete(t, f)
+		}
+		for k, child := range t {
+			t[k] = removeJSONFields(child, fields)
+		}
+	case []interface{}:
+		for i, child := range t {
+			t[i] = removeJSONFields(child, fields)
+		}
+	}
+	return v
+}
+
+// firstDiffOffset returns the offset of the first differing byte, or -1 if
+// the inputs are equal.
+func firstDiffOffset(a, b []byte) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		if len(a) < len(b) {
+			return len(a)
+		}
+		return len(b)
+	}
+	return -1
+}
+
+// diffContext returns the input data around the offset.
+func diffContext(data []byte, offset int) string {
+	const size = 40
+
+	start, end := offset-size, offset+size
+	if start < 0 {
+		start = 0
+	}
+	if end > len(data) {
+		end = len(data)
+	}
+	if start > end {
+		start = end
+	}
+	return string(data[start:end])
+}
+
+// BoundaryReport is the outcome of CheckQueryBoundary.
+type BoundaryReport struct {
+	// Equal is true if the straddling query result matches the stitched one.
+	Equal bool
+
+	// Diff describes the first difference found, if the results don't match.
+	Diff string
+}
+
+// CheckQueryBoundary runs a range query straddling the input boundary, e.g. the
+// time before which queries are served by the store-gateway instead of the
+// ingesters, then runs the same query over the two sub-ranges before and after
+// the boundary, stitches their results and compares them with the straddling
+// one. Sub-ranges are aligned to the step starting from start, so that the
+// stitched result is evaluated at the same timestamps of the straddling one.
+func CheckQueryBoundary(c *Client, query string, start, end, boundary time.Time, step time.Duration) (BoundaryReport, error) {
+	report := BoundaryReport{}
+
+	if !boundary.After(start) || !boundary.Before(end) {
+		return report, fmt.Errorf("boundary %v is not within the query time range [%v, %v]", boundary, start, end)
+	}
+
+	// The last step timestamp not after the boundary ends the first sub-range.
+	firstEnd := start.Add(boundary.Sub(start) / step * step)
+	secondStart := firstEnd.Add(step)
+
+	full, err := c.QueryRange(query, start, end, step)
+	if err != nil {
+		return report, fmt.Errorf("straddling query: %v", err)
+	}
+
+	first, err := c.QueryRange(query, start, firstEnd, step)
+	if err != nil {
+		return report, fmt.Errorf("query before the boundary: %v", err)
+	}
+
+	stitched := first
+	if !secondStart.After(end) {
+		second, err := c.QueryRange(query, secondStart, end, step)
+		if err != nil {
+			return report, fmt.Errorf("query after the boundary: %v", err)
+		}
+
+		stitched, err = stitchMatrices(first, second)
+		if err != nil {
+			return report, err
+		}
+	}
+
+	_, err = CompareValues(full, stitched, 0)
+	report.Equal = err == nil
+	if err != nil {
+		report.Diff = err.Error()
+	}
+
+	return report, nil
+}
+
+// stitchMatrices concatenates the samples of the series of two matrices over
+// consecutive time ranges.
+func stitchMatrices(first, second model.Value) (model.Matrix, error) {
+	a, ok := first.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("expected result type %s, got %s", model.ValMatrix, first.Type())
+	}
+	b, ok := second.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("expected result type %s, got %s", model.ValMatrix, second.Type())
+	}
+
+	byFingerprint := map[model.Fingerprint]*model.SampleStream{}
+	result := model.Matrix{}
+
+	for _, m := range []model.Matrix{a, b} {
+		for _, s := range m {
+			fp := s.Metric.Fingerprint()
+			if existing, ok := byFingerprint[fp]; ok {
+				existing.Values = append(existing.Values, s.Values...)
+				continue
+			}
+
+			stitched := &model.SampleStream{Metric: s.Metric, Values: append([]model.SamplePair(nil), s.Values...)}
+			byFingerprint[fp] = stitched
+			result = append(result, stitched)
+		}
+	}
+
+	return result, nil
+}
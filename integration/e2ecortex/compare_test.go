@@ -0,0 +1,289 @@
+package e2ecortex
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/value"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cortexproject/cortex/pkg/ingester/client"
+)
+
+func TestCompareValues(t *testing.T) {
+	series1 := model.Metric{"__name__": "series_1"}
+	series2 := model.Metric{"__name__": "series_2"}
+
+	tests := map[string]struct {
+		expected      model.Value
+		actual        model.Value
+		tolerance     float64
+		expectedDelta float64
+		expectedErr   string
+	}{
+		"equal vectors with different ordering": {
+			expected: model.Vector{{Metric: series1, Value: 1, Timestamp: 10}, {Metric: series2, Value: 2, Timestamp: 10}},
+			actual:   model.Vector{{Metric: series2, Value: 2, Timestamp: 10}, {Metric: series1, Value: 1, Timestamp: 10}},
+		},
+		"vectors within tolerance": {
+			expected:      model.Vector{{Metric: series1, Value: 1, Timestamp: 10}},
+			actual:        model.Vector{{Metric: series1, Value: 1.25, Timestamp: 10}},
+			tolerance:     0.5,
+			expectedDelta: 0.25,
+		},
+		"vectors exceeding tolerance": {
+			expected:      model.Vector{{Metric: series1, Value: 1, Timestamp: 10}},
+			actual:        model.Vector{{Metric: series1, Value: 2, Timestamp: 10}},
+			tolerance:     0.5,
+			expectedDelta: 1,
+			expectedErr:   "exceeds tolerance",
+		},
+		"vectors with missing series": {
+			expected:    model.Vector{{Metric: series1, Value: 1, Timestamp: 10}},
+			actual:      model.Vector{{Metric: series2, Value: 1, Timestamp: 10}},
+			expectedErr: "missing series",
+		},
+		"NaN values": {
+			expected: model.Vector{{Metric: series1, Value: model.SampleValue(math.NaN()), Timestamp: 10}},
+			actual:   model.Vector{{Metric: series1, Value: model.SampleValue(math.NaN()), Timestamp: 10}},
+		},
+		"matrices with different timestamps": {
+			expected:    model.Matrix{{Metric: series1, Values: []model.SamplePair{{Timestamp: 10, Value: 1}}}},
+			actual:      model.Matrix{{Metric: series1, Values: []model.SamplePair{{Timestamp: 20, Value: 1}}}},
+			expectedErr: "expected sample at",
+		},
+		"matrices with different number of samples": {
+			expected:    model.Matrix{{Metric: series1, Values: []model.SamplePair{{Timestamp: 10, Value: 1}}}},
+			actual:      model.Matrix{{Metric: series1}},
+			expectedErr: "expected 1 samples, got 0",
+		},
+		"different result types": {
+			expected:    model.Vector{},
+			actual:      model.Matrix{},
+			expectedErr: "expected result type vector, got matrix",
+		},
+		"scalars": {
+			expected:      &model.Scalar{Value: 1, Timestamp: 10},
+			actual:        &model.Scalar{Value: 1.5, Timestamp: 10},
+			tolerance:     1,
+			expectedDelta: 0.5,
+		},
+	}
+
+	for name, testData := range tests {
+		t.Run(name, func(t *testing.T) {
+			delta, err := CompareValues(testData.expected, testData.actual, testData.tolerance)
+			assert.Equal(t, testData.expectedDelta, delta)
+
+			if testData.expectedErr == "" {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), testData.expectedErr)
+			}
+		})
+	}
+}
+
+func TestCheckQuerySharding(t *testing.T) {
+	shardedQueries := 0
+	shardedValue := "1"
+
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/metrics" {
+			_, _ = fmt.Fprintf(w, "# TYPE cortex_frontend_sharded_queries_total counter\ncortex_frontend_sharded_queries_total %d\n", shardedQueries)
+			return
+		}
+
+		shardedQueries += 16
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"series_1"},"values":[[0,"%s"]]}]}}`, shardedValue)
+	}))
+	defer frontend.Close()
+
+	querier := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"series_1"},"values":[[0,"1"]]}]}}`))
+	}))
+	defer querier.Close()
+
+	sharded, err := NewClient("", strings.TrimPrefix(frontend.URL, "http://"), "", "", "user-1")
+	require.NoError(t, err)
+	unsharded, err := NewClient("", strings.TrimPrefix(querier.URL, "http://"), "", "", "user-1")
+	require.NoError(t, err)
+
+	report, err := CheckQuerySharding(sharded, unsharded, "sum(series_1)", time.Unix(0, 0), time.Unix(60, 0), 15*time.Second, 0)
+	require.NoError(t, err)
+	assert.Equal(t, QueryShardingReport{Equal: true, ShardedQueries: 16}, report)
+
+	shardedValue = "1.5"
+	report, err = CheckQuerySharding(sharded, unsharded, "sum(series_1)", time.Unix(0, 0), time.Unix(60, 0), 15*time.Second, 0.1)
+	require.NoError(t, err)
+	assert.False(t, report.Equal)
+	assert.Equal(t, 0.5, report.MaxDelta)
+	assert.Contains(t, report.Diff, "exceeds tolerance")
+}
+
+func TestCompareRemoteReadAndQueryRange(t *testing.T) {
+	series1 := []client.LabelAdapter{{Name: "__name__", Value: "series_1"}}
+	series2 := []client.LabelAdapter{{Name: "__name__", Value: "series_2"}}
+
+	// The series is marked stale at 60s, so it shouldn't be returned afterwards.
+	remoteRead := []client.TimeSeries{{
+		Labels: series1,
+		Samples: []client.Sample{
+			{TimestampMs: 0, Value: 1},
+			{TimestampMs: 30000, Value: 2},
+			{TimestampMs: 60000, Value: math.Float64frombits(value.StaleNaN)},
+		},
+	}}
+	queryRange := `[{"metric":{"__name__":"series_1"},"values":[[0,"1"],[15,"1"],[30,"2"],[45,"2"]]}]`
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/prom/api/v1/read":
+			compressed, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			data, err := snappy.Decode(nil, compressed)
+			require.NoError(t, err)
+
+			req := client.ReadRequest{}
+			require.NoError(t, proto.Unmarshal(data, &req))
+			require.Len(t, req.Queries, 1)
+			assert.Equal(t, int64(-300000), req.Queries[0].StartTimestampMs)
+			assert.Equal(t, int64(90000), req.Queries[0].EndTimestampMs)
+
+			data, err = proto.Marshal(&client.ReadResponse{Results: []*client.QueryResponse{{Timeseries: remoteRead}}})
+			require.NoError(t, err)
+
+			w.Header().Set("Content-Type", "application/x-protobuf")
+			_, _ = w.Write(snappy.Encode(nil, data))
+
+		case "/api/prom/api/v1/query_range":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":%s}}`, queryRange)
+
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	report, err := CompareRemoteReadAndQueryRange(c, `{__name__=~"series_.*"}`, time.Unix(0, 0), time.Unix(90, 0), 15*time.Second, 0)
+	require.NoError(t, err)
+	assert.Equal(t, RemoteReadReport{Equal: true}, report)
+
+	remoteRead = append(remoteRead, client.TimeSeries{Labels: series2, Samples: []client.Sample{{TimestampMs: 0, Value: 1}}})
+	queryRange = `[{"metric":{"__name__":"series_1"},"values":[[0,"1"],[15,"1"],[30,"3"],[45,"2"],[60,"2"]]},{"metric":{"__name__":"series_3"},"values":[[0,"1"]]}]`
+
+	report, err = CompareRemoteReadAndQueryRange(c, `{__name__=~"series_.*"}`, time.Unix(0, 0), time.Unix(90, 0), 15*time.Second, 0)
+	require.NoError(t, err)
+	assert.Equal(t, RemoteReadReport{
+		Equal:         false,
+		MissingSeries: []string{"series_2"},
+		ExtraSeries:   []string{"series_3"},
+		SampleDiffs: []string{
+			"series series_1 at 30: expected value 2, got 3 (delta 1 exceeds tolerance 0)",
+			"series series_1 at 60: unexpected sample with value 2",
+		},
+	}, report)
+}
+
+func TestCheckQueryDeterminism(t *testing.T) {
+	responses := []string{
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"series_1"},"value":[1,"1"]},{"metric":{"__name__":"series_2"},"value":[1,"2"]}],"stats":{"timings":{"evalTotalTime":0.1}}}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"series_1"},"value":[1,"1"]},{"metric":{"__name__":"series_2"},"value":[1,"2"]}],"stats":{"timings":{"evalTotalTime":0.2}}}}`,
+		`{"status":"success","data":{"resultType":"vector","result":[{"metric":{"__name__":"series_2"},"value":[1,"2"]},{"metric":{"__name__":"series_1"},"value":[1,"1"]}],"stats":{"timings":{"evalTotalTime":0.1}}}}`,
+	}
+
+	newReplica := func(response *string) *Client {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(*response))
+		}))
+		t.Cleanup(server.Close)
+
+		return newTestClient(t, server, "user-1")
+	}
+
+	query := func(c *Client) (*http.Response, []byte, error) {
+		return c.QueryRaw("series_1 or series_2", time.Unix(1, 0))
+	}
+
+	// Stats timings vary between replicas, but should be ignored once normalized.
+	replicas := []*Client{newReplica(&responses[0]), newReplica(&responses[1])}
+
+	report, err := CheckQueryDeterminism(replicas, 4, query, nil)
+	require.NoError(t, err)
+	assert.False(t, report.Deterministic)
+	assert.Equal(t, 1, report.FirstDiffRun)
+
+	report, err = CheckQueryDeterminism(replicas, 4, query, WithoutJSONFields("stats"))
+	require.NoError(t, err)
+	assert.Equal(t, DeterminismReport{Deterministic: true, FirstDiffRun: -1, FirstDiffOffset: -1}, report)
+
+	// A different series ordering should be detected.
+	replicas = append(replicas, newReplica(&responses[2]))
+
+	report, err = CheckQueryDeterminism(replicas, 4, query, WithoutJSONFields("stats"))
+	require.NoError(t, err)
+	assert.False(t, report.Deterministic)
+	assert.Equal(t, 2, report.FirstDiffRun)
+	assert.Equal(t, len(`{"data":{"result":[{"metric":{"__name__":"series_`), report.FirstDiffOffset)
+	assert.Contains(t, report.Diff, "series_2")
+}
+
+func TestCheckQueryBoundary(t *testing.T) {
+	// Samples are at every 15s from 0 to 120s, the boundary being at 70s.
+	duplicateAtBoundary := false
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		start, err := strconv.ParseFloat(r.Form.Get("start"), 64)
+		require.NoError(t, err)
+		end, err := strconv.ParseFloat(r.Form.Get("end"), 64)
+		require.NoError(t, err)
+
+		values := []string{}
+		for ts := int(start); ts <= int(end); ts += 15 {
+			values = append(values, fmt.Sprintf(`[%d,"%d"]`, ts, ts))
+
+			// Simulate a sample returned by both backends at the cutover.
+			if duplicateAtBoundary && ts == 60 && start == 0 && end == 120 {
+				values = append(values, `[60,"60"]`)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"__name__":"series_1"},"values":[%s]}]}}`, strings.Join(values, ","))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	report, err := CheckQueryBoundary(c, "series_1", time.Unix(0, 0), time.Unix(120, 0), time.Unix(70, 0), 15*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, BoundaryReport{Equal: true}, report)
+
+	duplicateAtBoundary = true
+	report, err = CheckQueryBoundary(c, "series_1", time.Unix(0, 0), time.Unix(120, 0), time.Unix(70, 0), 15*time.Second)
+	require.NoError(t, err)
+	assert.False(t, report.Equal)
+	assert.Contains(t, report.Diff, "expected 10 samples, got 9")
+
+	_, err = CheckQueryBoundary(c, "series_1", time.Unix(0, 0), time.Unix(120, 0), time.Unix(200, 0), 15*time.Second)
+	require.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package e2ecortex
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// DecodedSample is a sample of a DecodedSeries.
+type DecodedSample struct {
+	T time.Time
+	V float64
+}
+
+// DecodedSeries is a series of a matrix, whose labels are encoded as a
+// canonical string, e.g. series_1{job="test"}.
+type DecodedSeries struct {
+	Labels  string
+	Samples []DecodedSample
+}
+
+// VectorToMap returns the samples of the input vector, keyed by the canonical
+// string of their labels, e.g. series_1{job="test"}. Returns an error if the
+// value is not a vector.
+func VectorToMap(value model.Value) (map[string]float64, error) {
+	vector, ok := value.(model.Vector)
+	if !ok {
+		return nil, fmt.Errorf("expected result type %s, got %s", model.ValVector, valueType(value))
+	}
+
+	result := make(map[string]float64, len(vector))
+	for _, s := range vector {
+		key := s.Metric.String()
+		if _, ok := result[key]; ok {
+			return nil, fmt.Errorf("duplicate series %s in vector", key)
+		}
+		result[key] = float64(s.Value)
+	}
+	return result, nil
+}
+
+// MatrixToSeries returns the series of the input matrix, sorted by the
+// canonical string of their labels. Returns an error if the value is not a matrix.
+func MatrixToSeries(value model.Value) ([]DecodedSeries, error) {
+	matrix, ok := value.(model.Matrix)
+	if !ok {
+		return nil, fmt.Errorf("expected result type %s, got %s", model.ValMatrix, valueType(value))
+	}
+
+	result := make([]DecodedSeries, 0, len(matrix))
+	for _, stream := range matrix {
+		series := DecodedSeries{
+			Labels:  stream.Metric.String(),
+			Samples: make([]DecodedSample, 0, len(stream.Values)),
+		}
+		for _, v := range stream.Values {
+			series.Samples = append(series.Samples, DecodedSample{T: v.Timestamp.Time(), V: float64(v.Value)})
+		}
+		result = append(result, series)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Labels < result[j].Labels })
+	return result, nil
+}
+
+// MapToVector builds a vector from samples keyed by the canonical string of
+// their labels, all having the input timestamp. It's the inverse of VectorToMap,
+// to build the expected result of an instant query.
+func MapToVector(samples map[string]float64, ts time.Time) (model.Vector, error) {
+	vector := make(model.Vector, 0, len(samples))
+	for key, v := range samples {
+		metric, err := parseMetric(key)
+		if err != nil {
+			return nil, err
+		}
+		vector = append(vector, &model.Sample{Metric: metric, Value: model.SampleValue(v), Timestamp: model.TimeFromUnixNano(ts.UnixNano())})
+	}
+
+	sort.Slice(vector, func(i, j int) bool { return vector[i].Metric.String() < vector[j].Metric.String() })
+	return vector, nil
+}
+
+// SeriesToMatrix builds a matrix from the input series. It's the inverse of
+// MatrixToSeries, to build the expected result of a range query.
+func SeriesToMatrix(series []DecodedSeries) (model.Matrix, error) {
+	matrix := make(model.Matrix, 0, len(series))
+	for _, s := range series {
+		metric, err := parseMetric(s.Labels)
+		if err != nil {
+			return nil, err
+		}
+
+		stream := &model.SampleStream{Metric: metric, Values: make([]model.SamplePair, 0, len(s.Samples))}
+		for _, sample := range s.Samples {
+			stream.Values = append(stream.Values, model.SamplePair{Timestamp: model.TimeFromUnixNano(sample.T.UnixNano()), Value: model.SampleValue(sample.V)})
+		}
+		matrix = append(matrix, stream)
+	}
+	return matrix, nil
+}
+
+// parseMetric parses the canonical string of a metric labels.
+func parseMetric(s string) (model.Metric, error) {
+	lbls, err := parser.ParseMetric(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid series labels %q: %v", s, err)
+	}
+
+	metric := make(model.Metric, len(lbls))
+	for _, l := range lbls {
+		metric[model.LabelName(l.Name)] = model.LabelValue(l.Value)
+	}
+	return metric, nil
+}
+
+// valueType returns the type of the input value, handling nil values.
+func valueType(value model.Value) string {
+	if value == nil {
+		return "nil"
+	}
+	return value.Type().String()
+}
@@ -0,0 +1,70 @@
+package e2ecortex
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorToMap(t *testing.T) {
+	ts := time.Unix(1000, 0)
+
+	vector := model.Vector{
+		{Metric: model.Metric{"__name__": "series_1", "job": "test"}, Value: 1, Timestamp: model.TimeFromUnixNano(ts.UnixNano())},
+		{Metric: model.Metric{"job": `say "hi"`}, Value: 2, Timestamp: model.TimeFromUnixNano(ts.UnixNano())},
+		{Metric: model.Metric{}, Value: 3, Timestamp: model.TimeFromUnixNano(ts.UnixNano())},
+	}
+
+	samples, err := VectorToMap(vector)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]float64{
+		`series_1{job="test"}`: 1,
+		`{job="say \"hi\""}`:   2,
+		`{}`:                   3,
+	}, samples)
+
+	// The map should convert back to the same vector.
+	rebuilt, err := MapToVector(samples, ts)
+	require.NoError(t, err)
+	_, err = CompareValues(vector, rebuilt, 0)
+	require.NoError(t, err)
+
+	// Duplicate series and unexpected types should be reported.
+	_, err = VectorToMap(append(vector, vector[0]))
+	require.Error(t, err)
+
+	_, err = VectorToMap(model.Matrix{})
+	require.EqualError(t, err, "expected result type vector, got matrix")
+
+	_, err = VectorToMap(nil)
+	require.EqualError(t, err, "expected result type vector, got nil")
+
+	_, err = MapToVector(map[string]float64{"series_1{": 1}, ts)
+	require.Error(t, err)
+}
+
+func TestMatrixToSeries(t *testing.T) {
+	matrix := model.Matrix{
+		{Metric: model.Metric{"__name__": "series_2"}, Values: []model.SamplePair{{Timestamp: 1000, Value: 3}}},
+		{Metric: model.Metric{"__name__": "series_1", "job": "test"}, Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 2000, Value: 2}}},
+	}
+
+	series, err := MatrixToSeries(matrix)
+	require.NoError(t, err)
+	assert.Equal(t, []DecodedSeries{
+		{Labels: `series_1{job="test"}`, Samples: []DecodedSample{{T: time.Unix(1, 0), V: 1}, {T: time.Unix(2, 0), V: 2}}},
+		{Labels: `series_2`, Samples: []DecodedSample{{T: time.Unix(1, 0), V: 3}}},
+	}, series)
+
+	// The series should convert back to the same matrix.
+	rebuilt, err := SeriesToMatrix(series)
+	require.NoError(t, err)
+	_, err = CompareValues(matrix, rebuilt, 0)
+	require.NoError(t, err)
+
+	_, err = MatrixToSeries(model.Vector{})
+	require.EqualError(t, err, "expected result type matrix, got vector")
+}
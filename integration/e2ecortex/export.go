@@ -0,0 +1,176 @@
+package e2ecortex
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// WriteJSON writes the input vector or matrix to w as pretty printed JSON, in
+// the same format as a Prometheus query API response. Series are sorted by
+// labels, and samples by timestamp, so that the output is stable across runs.
+func WriteJSON(w io.Writer, value model.Value) error {
+	value, err := sortedValue(value)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(struct {
+		Status string `json:"status"`
+		Data   struct {
+			ResultType string      `json:"resultType"`
+			Result     model.Value `json:"result"`
+		} `json:"data"`
+	}{
+		Status: "success",
+		Data: struct {
+			ResultType string      `json:"resultType"`
+			Result     model.Value `json:"result"`
+		}{ResultType: value.Type().String(), Result: value},
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// WriteJSONFile writes the input vector or matrix to the file at path, as WriteJSON does.
+func WriteJSONFile(path string, value model.Value) error {
+	return writeFile(path, func(w io.Writer) error { return WriteJSON(w, value) })
+}
+
+// ReadJSON reads a vector or matrix written by WriteJSON, or a raw Prometheus
+// query API response, e.g. to compare a query result with a golden file.
+func ReadJSON(r io.Reader) (model.Value, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJSONQueryResponse(data)
+}
+
+// ReadJSONFile reads a vector or matrix from the file at path, as ReadJSON does.
+func ReadJSONFile(path string) (model.Value, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadJSON(f)
+}
+
+// WriteCSV writes the input vector or matrix to w as CSV, with one row per
+// series, timestamp and value. Rows are sorted by labels and then timestamp,
+// so that the output is stable across runs.
+func WriteCSV(w io.Writer, value model.Value) error {
+	value, err := sortedValue(value)
+	if err != nil {
+		return err
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"series", "timestamp", "value"}); err != nil {
+		return err
+	}
+
+	writeRow := func(metric model.Metric, ts model.Time, v model.SampleValue) error {
+		return cw.Write([]string{metric.String(), ts.String(), strconv.FormatFloat(float64(v), 'f', -1, 64)})
+	}
+
+	switch v := value.(type) {
+	case model.Vector:
+		for _, s := range v {
+			if err := writeRow(s.Metric, s.Timestamp, s.Value); err != nil {
+				return err
+			}
+		}
+	case model.Matrix:
+		for _, s := range v {
+			for _, p := range s.Values {
+				if err := writeRow(s.Metric, p.Timestamp, p.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteCSVFile writes the input vector or matrix to the file at path, as WriteCSV does.
+func WriteCSVFile(path string, value model.Value) error {
+	return writeFile(path, func(w io.Writer) error { return WriteCSV(w, value) })
+}
+
+// sortedValue returns a sorted copy of the input vector or matrix.
+func sortedValue(value model.Value) (model.Value, error) {
+	switch v := value.(type) {
+	case model.Vector:
+		sorted := make(model.Vector, len(v))
+		copy(sorted, v)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if c := compareMetrics(sorted[i].Metric, sorted[j].Metric); c != 0 {
+				return c < 0
+			}
+			return sorted[i].Timestamp.Before(sorted[j].Timestamp)
+		})
+		return sorted, nil
+
+	case model.Matrix:
+		sorted := make(model.Matrix, 0, len(v))
+		for _, s := range v {
+			values := make([]model.SamplePair, len(s.Values))
+			copy(values, s.Values)
+			sort.Slice(values, func(i, j int) bool { return values[i].Timestamp.Before(values[j].Timestamp) })
+
+			sorted = append(sorted, &model.SampleStream{Metric: s.Metric, Values: values})
+		}
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return compareMetrics(sorted[i].Metric, sorted[j].Metric) < 0
+		})
+		return sorted, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported result type %s, only vectors and matrices can be exported", value.Type())
+	}
+}
+
+// compareMetrics compares two metrics label by label, in label name order.
+func compareMetrics(a, b model.Metric) int {
+	return labels.Compare(metricToLabels(a), metricToLabels(b))
+}
+
+func metricToLabels(m model.Metric) labels.Labels {
+	ls := make(labels.Labels, 0, len(m))
+	for name, value := range m {
+		ls = append(ls, labels.Label{Name: string(name), Value: string(value)})
+	}
+	sort.Sort(ls)
+	return ls
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,70 @@
+package e2ecortex
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExport(t *testing.T) {
+	matrix := model.Matrix{
+		{Metric: model.Metric{"__name__": "series_2"}, Values: []model.SamplePair{{Timestamp: 2000, Value: 4}, {Timestamp: 1000, Value: 3}}},
+		{Metric: model.Metric{"__name__": "series_1", "job": "a"}, Values: []model.SamplePair{{Timestamp: 1000, Value: 1.5}}},
+	}
+
+	expectedMatrix := model.Matrix{
+		{Metric: model.Metric{"__name__": "series_1", "job": "a"}, Values: []model.SamplePair{{Timestamp: 1000, Value: 1.5}}},
+		{Metric: model.Metric{"__name__": "series_2"}, Values: []model.SamplePair{{Timestamp: 1000, Value: 3}, {Timestamp: 2000, Value: 4}}},
+	}
+
+	t.Run("CSV", func(t *testing.T) {
+		buf := bytes.Buffer{}
+		require.NoError(t, WriteCSV(&buf, matrix))
+		assert.Equal(t, `series,timestamp,value
+"series_1{job=""a""}",1,1.5
+series_2,1,3
+series_2,2,4
+`, buf.String())
+
+		buf.Reset()
+		require.NoError(t, WriteCSV(&buf, model.Vector{
+			{Metric: model.Metric{"__name__": "series_2"}, Timestamp: 1000, Value: 2},
+			{Metric: model.Metric{"__name__": "series_1"}, Timestamp: 1000, Value: 1},
+		}))
+		assert.Equal(t, "series,timestamp,value\nseries_1,1,1\nseries_2,1,2\n", buf.String())
+	})
+
+	t.Run("JSON round trip", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "export")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "result.json")
+		require.NoError(t, WriteJSONFile(path, matrix))
+
+		// The input should be left untouched.
+		assert.Equal(t, model.Time(2000), matrix[0].Values[0].Timestamp)
+
+		value, err := ReadJSONFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, expectedMatrix, value)
+
+		// The output should be stable.
+		first, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		require.NoError(t, WriteJSONFile(path, expectedMatrix))
+		second, err := ioutil.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, string(first), string(second))
+	})
+
+	t.Run("unsupported type", func(t *testing.T) {
+		assert.Error(t, WriteJSON(&bytes.Buffer{}, &model.Scalar{Value: 1}))
+	})
+}
@@ -0,0 +1,93 @@
+package e2ecortex
+
+import (
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	"github.com/cortexproject/cortex/integration/e2e"
+)
+
+// AlignToStep returns the input time truncated to a multiple of step since the
+// Unix epoch. This is how the query frontend aligns range queries when step
+// alignment is enabled.
+func AlignToStep(t time.Time, step time.Duration) time.Time {
+	if step <= 0 {
+		return t
+	}
+
+	stepMs := int64(step / time.Millisecond)
+	ms := t.UnixNano() / int64(time.Millisecond)
+
+	aligned := ms - ms%stepMs
+	if ms < 0 && ms%stepMs != 0 {
+		aligned -= stepMs
+	}
+	return time.Unix(0, aligned*int64(time.Millisecond))
+}
+
+// ExpectedPointCount returns the number of points a range query over the input
+// time range returns for a series having a sample at every step.
+func ExpectedPointCount(start, end time.Time, step time.Duration) int {
+	if step <= 0 || end.Before(start) {
+		return 0
+	}
+	return int(end.Sub(start)/step) + 1
+}
+
+// RangeSpec is the time range and step of a range query. Pushed samples, the
+// query parameters and the expected results should all be derived from the
+// same spec, so that they're consistent.
+type RangeSpec struct {
+	Start time.Time
+	End   time.Time
+	Step  time.Duration
+}
+
+// NewRangeSpec returns a RangeSpec whose start and end are aligned to the step.
+func NewRangeSpec(start, end time.Time, step time.Duration) RangeSpec {
+	return RangeSpec{
+		Start: AlignToStep(start, step),
+		End:   AlignToStep(end, step),
+		Step:  step,
+	}
+}
+
+// PointCount returns the number of points of a series having a sample at every step.
+func (r RangeSpec) PointCount() int {
+	return ExpectedPointCount(r.Start, r.End, r.Step)
+}
+
+// Timestamps returns the timestamps at which the range query is evaluated.
+func (r RangeSpec) Timestamps() []time.Time {
+	timestamps := make([]time.Time, 0, r.PointCount())
+	for i := 0; i < r.PointCount(); i++ {
+		timestamps = append(timestamps, r.Start.Add(time.Duration(i)*r.Step))
+	}
+	return timestamps
+}
+
+// GenerateSeries generates a series with a random sample at every step, along
+// with the matrix expected when querying it with the spec. Samples are
+// generated by e2e.GenerateSeries. No series is returned if the spec has no
+// points.
+func (r RangeSpec) GenerateSeries(name string, additionalLabels ...prompb.Label) (series []prompb.TimeSeries, matrix model.Matrix) {
+	for _, t := range r.Timestamps() {
+		s, v := e2e.GenerateSeries(name, t, additionalLabels...)
+		if len(series) == 0 {
+			series = []prompb.TimeSeries{{Labels: s[0].Labels}}
+			matrix = model.Matrix{{Metric: v[0].Metric}}
+		}
+
+		series[0].Samples = append(series[0].Samples, s[0].Samples...)
+		matrix[0].Values = append(matrix[0].Values, model.SamplePair{Value: v[0].Value, Timestamp: v[0].Timestamp})
+	}
+
+	return series, matrix
+}
+
+// QueryRangeSpec runs a range query over the spec time range and step.
+func (c *Client) QueryRangeSpec(query string, spec RangeSpec, opts ...QueryOption) (model.Value, error) {
+	return c.QueryRange(query, spec.Start, spec.End, spec.Step, opts...)
+}
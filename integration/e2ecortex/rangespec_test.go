@@ -0,0 +1,59 @@
+package e2ecortex
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlignToStep(t *testing.T) {
+	assert.Equal(t, time.Unix(60, 0), AlignToStep(time.Unix(74, 999000000), 15*time.Second))
+	assert.Equal(t, time.Unix(75, 0), AlignToStep(time.Unix(75, 0), 15*time.Second))
+	assert.Equal(t, time.Unix(0, 0), AlignToStep(time.Unix(6, 0), 7*time.Second))
+	assert.Equal(t, time.Unix(-15, 0), AlignToStep(time.Unix(-1, 0), 15*time.Second))
+}
+
+func TestExpectedPointCount(t *testing.T) {
+	assert.Equal(t, 5, ExpectedPointCount(time.Unix(0, 0), time.Unix(60, 0), 15*time.Second))
+	assert.Equal(t, 4, ExpectedPointCount(time.Unix(0, 0), time.Unix(59, 0), 15*time.Second))
+	assert.Equal(t, 1, ExpectedPointCount(time.Unix(0, 0), time.Unix(0, 0), 15*time.Second))
+	assert.Equal(t, 0, ExpectedPointCount(time.Unix(60, 0), time.Unix(0, 0), 15*time.Second))
+}
+
+func TestRangeSpec(t *testing.T) {
+	spec := NewRangeSpec(time.Unix(1600000003, 0), time.Unix(1600000064, 0), 15*time.Second)
+	assert.Equal(t, RangeSpec{Start: time.Unix(1599999990, 0), End: time.Unix(1600000050, 0), Step: 15 * time.Second}, spec)
+	assert.Equal(t, 5, spec.PointCount())
+	assert.Len(t, spec.Timestamps(), 5)
+
+	series, expected := spec.GenerateSeries("series_1", prompb.Label{Name: "job", Value: "test"})
+	require.Len(t, series, 1)
+	require.Len(t, series[0].Samples, 5)
+	assert.Equal(t, int64(1599999990000), series[0].Samples[0].Timestamp)
+	assert.Equal(t, int64(1600000050000), series[0].Samples[4].Timestamp)
+	assert.Equal(t, model.Metric{"__name__": "series_1", "job": "test"}, expected[0].Metric)
+
+	// The range query should be issued with the aligned spec.
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		assert.Equal(t, "1599999990", r.Form.Get("start"))
+		assert.Equal(t, "1600000050", r.Form.Get("end"))
+		assert.Equal(t, "15", r.Form.Get("step"))
+
+		w.Header().Set("Content-Type", "application/json")
+		require.NoError(t, WriteJSON(w, expected))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	result, err := c.QueryRangeSpec("series_1", spec)
+	require.NoError(t, err)
+	assert.Equal(t, expected, result)
+}
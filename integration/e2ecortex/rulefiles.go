@@ -0,0 +1,240 @@
+package e2ecortex
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	tsdb_errors "github.com/prometheus/prometheus/tsdb/errors"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cortexproject/cortex/pkg/ruler"
+)
+
+// ruleFileNamespacePrefix prefixes the comment recording the original namespace
+// at the top of the rule files written by ExportRuleGroups, because the file
+// name may be sanitized.
+const ruleFileNamespacePrefix = "# namespace: "
+
+// unsafeFileNameChars matches the characters replaced in the rule file names.
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+
+// ExportRuleGroups writes the tenant's rule groups to the input directory, one
+// Prometheus rule file per namespace, and returns the paths of the files written,
+// sorted by namespace. Files are named after their namespace, sanitized for the
+// filesystem, and record the original namespace in a leading comment. Groups
+// are sorted by name, so that the output is stable across runs.
+func (c *Client) ExportRuleGroups(dir string) ([]string, error) {
+	namespaces, err := c.ListRuleNamespaces()
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		return nil, nil
+	}
+
+	rgs, err := c.GetRuleGroups()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(rgs))
+	for namespace := range rgs {
+		names = append(names, namespace)
+	}
+	sort.Strings(names)
+
+	var (
+		files = make([]string, 0, len(names))
+		used  = map[string]bool{}
+	)
+
+	for _, namespace := range names {
+		groups := append([]RuleGroup(nil), rgs[namespace]...)
+		sort.SliceStable(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+
+		path := filepath.Join(dir, ruleFileName(namespace, used)+".yaml")
+		if err := writeFile(path, func(w io.Writer) error {
+			return writeRuleFile(w, namespace, groups)
+		}); err != nil {
+			return files, fmt.Errorf("exporting namespace %q: %v", namespace, err)
+		}
+		files = append(files, path)
+	}
+
+	return files, nil
+}
+
+// ruleFileName returns the name, without extension, of the rule file of the
+// input namespace, which is not in the input used names. The name is added to
+// the used names.
+func ruleFileName(namespace string, used map[string]bool) string {
+	base := unsafeFileNameChars.ReplaceAllString(namespace, "_")
+	if base == "" || base == "." || base == ".." {
+		base = "_" + base
+	}
+
+	name := base
+	for i := 1; used[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	used[name] = true
+	return name
+}
+
+// writeRuleFile writes the input groups in the Prometheus rule file format,
+// preceded by a comment recording the input namespace.
+func writeRuleFile(w io.Writer, namespace string, groups []RuleGroup) error {
+	if _, err := io.WriteString(w, ruleFileNamespacePrefix+strconv.Quote(namespace)+"\n"); err != nil {
+		return err
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(struct {
+		Groups []RuleGroup `yaml:"groups"`
+	}{Groups: groups}); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// ImportRuleGroups uploads the rule groups of the Prometheus rule files found in
+// the input directory, and its subdirectories. The namespace of each file is
+// the one recorded by ExportRuleGroups, if any, or the file name without its
+// extension. All the files are parsed and validated before uploading any group,
+// and the returned error names the file and group which failed. If wipe is
+// true, the tenant's existing rule groups are deleted before the upload.
+func (c *Client) ImportRuleGroups(dir string, wipe bool) error {
+	groups := map[string][]RuleGroup{}
+	files := map[string]string{}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+
+		namespace, rgs, err := readRuleFile(path)
+		if err != nil {
+			return err
+		}
+		if other, ok := files[namespace]; ok {
+			return fmt.Errorf("rule files %s and %s have the same namespace %q", other, path, namespace)
+		}
+
+		files[namespace] = path
+		groups[namespace] = rgs
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if wipe {
+		if err := c.deleteRuleGroups(); err != nil {
+			return err
+		}
+	}
+
+	namespaces := make([]string, 0, len(groups))
+	for namespace := range groups {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		for _, rg := range groups[namespace] {
+			if err := c.SetRuleGroup(rg, namespace); err != nil {
+				return fmt.Errorf("importing rule group %q of %s: %w", rg.Name, files[namespace], err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readRuleFile parses and validates the input Prometheus rule file, returning
+// its namespace and rule groups.
+func readRuleFile(path string) (string, []RuleGroup, error) {
+	namespace, err := ruleFileNamespace(path)
+	if err != nil {
+		return "", nil, err
+	}
+
+	parsed, errs := rulefmt.ParseFile(path)
+	if len(errs) > 0 {
+		merr := tsdb_errors.MultiError{}
+		for _, err := range errs {
+			merr.Add(fmt.Errorf("parsing rule file %s: %v", path, err))
+		}
+		return "", nil, merr.Err()
+	}
+
+	merr := tsdb_errors.MultiError{}
+	rgs := make([]RuleGroup, 0, len(parsed.Groups))
+	for _, rg := range parsed.Groups {
+		for _, err := range ruler.ValidateRuleGroup(rg) {
+			merr.Add(fmt.Errorf("invalid rule group %q of %s: %v", rg.Name, path, err))
+		}
+		rgs = append(rgs, RuleGroupFromRulefmt(rg))
+	}
+
+	return namespace, rgs, merr.Err()
+}
+
+// ruleFileNamespace returns the namespace recorded in the leading comment of the
+// input rule file, or the file name without its extension if there's none.
+func ruleFileNamespace(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+
+	if strings.HasPrefix(line, ruleFileNamespacePrefix) {
+		namespace, err := strconv.Unquote(strings.TrimSpace(strings.TrimPrefix(line, ruleFileNamespacePrefix)))
+		if err != nil {
+			return "", fmt.Errorf("invalid namespace in rule file %s: %v", path, err)
+		}
+		return namespace, nil
+	}
+
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base)), nil
+}
+
+// deleteRuleGroups deletes all the tenant's rule groups.
+func (c *Client) deleteRuleGroups() error {
+	namespaces, err := c.ListRuleNamespaces()
+	if err != nil || len(namespaces) == 0 {
+		return err
+	}
+
+	rgs, err := c.GetRuleGroups()
+	if err != nil {
+		return err
+	}
+
+	for _, namespace := range namespaces {
+		for _, rg := range rgs[namespace] {
+			if err := c.DeleteRuleGroup(namespace, rg.Name); err != nil {
+				return fmt.Errorf("deleting rule group %q of namespace %q: %w", rg.Name, namespace, err)
+			}
+		}
+	}
+
+	return nil
+}
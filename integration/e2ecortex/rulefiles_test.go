@@ -0,0 +1,232 @@
+package e2ecortex
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestClient_ExportRuleGroups(t *testing.T) {
+	rule := []Rule{{Record: "rule", Expr: "up"}}
+	rgs := map[string][]RuleGroup{
+		"team/a": {{Name: "group-b", Rules: rule}, {Name: "group-a", Rules: rule}},
+		"team_a": {{Name: "group", Rules: rule}},
+		"..":     {{Name: "group", Rules: rule}},
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/prom/rules", r.URL.Path)
+
+		data, err := yaml.Marshal(rgs)
+		require.NoError(t, err)
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	c := newTestClient(t, server, "user-1")
+
+	files, err := c.ExportRuleGroups(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "_...yaml"),
+		filepath.Join(dir, "team_a.yaml"),
+		filepath.Join(dir, "team_a_1.yaml"),
+	}, files)
+
+	// Each file should be a valid rule file, recording the original namespace.
+	for i, namespace := range []string{"..", "team/a", "team_a"} {
+		groups, errs := rulefmt.ParseFile(files[i])
+		require.Empty(t, errs)
+
+		var actual []RuleGroup
+		for _, rg := range groups.Groups {
+			actual = append(actual, RuleGroupFromRulefmt(rg))
+		}
+
+		expected := rgs[namespace]
+		if namespace == "team/a" {
+			expected = []RuleGroup{expected[1], expected[0]}
+		}
+		assert.Equal(t, expected, actual)
+
+		data, err := ioutil.ReadFile(files[i])
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(string(data), ruleFileNamespacePrefix+`"`+namespace+`"`+"\n"))
+	}
+
+	// The output should be stable.
+	first, err := ioutil.ReadFile(files[1])
+	require.NoError(t, err)
+	_, err = c.ExportRuleGroups(dir)
+	require.NoError(t, err)
+	second, err := ioutil.ReadFile(files[1])
+	require.NoError(t, err)
+	assert.Equal(t, string(first), string(second))
+}
+
+func TestClient_ExportRuleGroups_NoRuleGroups(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no rule groups found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	files, err := c.ExportRuleGroups("unused")
+	require.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+// newFakeRuler returns a server storing the rule groups uploaded through the
+// ruler API in the input map, keyed by namespace.
+func newFakeRuler(t *testing.T, rgs map[string][]RuleGroup) *httptest.Server {
+	mtx := sync.Mutex{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mtx.Lock()
+		defer mtx.Unlock()
+
+		parts := strings.Split(strings.TrimPrefix(r.URL.EscapedPath(), "/api/prom/rules"), "/")
+		for i := range parts {
+			var err error
+			parts[i], err = url.PathUnescape(parts[i])
+			require.NoError(t, err)
+		}
+
+		switch {
+		case r.Method == http.MethodGet && len(parts) == 1:
+			if len(rgs) == 0 {
+				http.Error(w, "no rule groups found", http.StatusNotFound)
+				return
+			}
+			data, err := yaml.Marshal(rgs)
+			require.NoError(t, err)
+			_, _ = w.Write(data)
+
+		case r.Method == http.MethodPost && len(parts) == 2:
+			body, err := ioutil.ReadAll(r.Body)
+			require.NoError(t, err)
+			rg, err := decodeRuleGroup(body)
+			require.NoError(t, err)
+
+			namespace := parts[1]
+			for i, existing := range rgs[namespace] {
+				if existing.Name == rg.Name {
+					rgs[namespace][i] = rg
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+			}
+			rgs[namespace] = append(rgs[namespace], rg)
+			w.WriteHeader(http.StatusAccepted)
+
+		case r.Method == http.MethodDelete && len(parts) == 3:
+			namespace := parts[1]
+			for i, existing := range rgs[namespace] {
+				if existing.Name == parts[2] {
+					rgs[namespace] = append(rgs[namespace][:i], rgs[namespace][i+1:]...)
+					if len(rgs[namespace]) == 0 {
+						delete(rgs, namespace)
+					}
+					w.WriteHeader(http.StatusAccepted)
+					return
+				}
+			}
+			w.WriteHeader(http.StatusNotFound)
+
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestClient_ImportRuleGroups(t *testing.T) {
+	rule := []Rule{{Record: "rule", Expr: "up"}}
+	exported := map[string][]RuleGroup{
+		"team/a": {{Name: "group-a", Rules: rule}, {Name: "group-b", Rules: rule}},
+		"team_a": {{Name: "group", Rules: rule}},
+	}
+
+	dir, err := ioutil.TempDir("", "rules")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	source := newFakeRuler(t, exported)
+	defer source.Close()
+
+	_, err = newTestClient(t, source, "user-1").ExportRuleGroups(dir)
+	require.NoError(t, err)
+
+	// A rule file not written by ExportRuleGroups, in a subdirectory.
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "prod"), 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "prod", "alerts.yml"), []byte(`
+groups:
+- name: instances
+  rules:
+  - alert: InstanceDown
+    expr: up == 0
+    for: 5m
+`), 0644))
+
+	rgs := map[string][]RuleGroup{
+		"stale": {{Name: "group", Rules: rule}},
+	}
+	target := newFakeRuler(t, rgs)
+	defer target.Close()
+
+	c := newTestClient(t, target, "user-1")
+
+	require.NoError(t, c.ImportRuleGroups(dir, false))
+	assert.Len(t, rgs, 4)
+	assert.Equal(t, exported["team/a"], rgs["team/a"])
+	assert.Equal(t, exported["team_a"], rgs["team_a"])
+	assert.Equal(t, []RuleGroup{{Name: "instances", Rules: []Rule{{Alert: "InstanceDown", Expr: "up == 0", For: model.Duration(5 * time.Minute)}}}}, rgs["alerts"])
+
+	// The existing rule groups should be deleted when wiping.
+	require.NoError(t, c.ImportRuleGroups(dir, true))
+	assert.Len(t, rgs, 3)
+	assert.NotContains(t, rgs, "stale")
+
+	// Invalid rule files should be reported, without uploading any group.
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "prod", "invalid.yaml"), []byte(`
+groups:
+- name: invalid
+  rules:
+  - record: rule
+    expr: sum(
+`), 0644))
+
+	for namespace := range rgs {
+		delete(rgs, namespace)
+	}
+
+	err = c.ImportRuleGroups(dir, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), filepath.Join(dir, "prod", "invalid.yaml"))
+	assert.Empty(t, rgs)
+
+	// Files with the same namespace should be rejected.
+	require.NoError(t, os.Remove(filepath.Join(dir, "prod", "invalid.yaml")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "alerts.yaml"), nil, 0644))
+
+	err = c.ImportRuleGroups(dir, true)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `have the same namespace "alerts"`)
+}
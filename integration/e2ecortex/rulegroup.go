@@ -0,0 +1,234 @@
+package e2ecortex
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	tsdb_errors "github.com/prometheus/prometheus/tsdb/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// RuleGroup is a rule group, as uploaded to and returned by the ruler API.
+// Unlike rulefmt.RuleGroup, whose rules are backed by YAML nodes, it only
+// contains plain values, so it can be safely marshalled and compared.
+type RuleGroup struct {
+	Name     string         `yaml:"name"`
+	Interval model.Duration `yaml:"interval,omitempty"`
+
+	// Limit is the max number of alerts or series each rule of the group can
+	// produce. It's dropped by the conversion to rulefmt.RuleGroup.
+	// TODO: pass the limit through once rulefmt and the ruler support it.
+	Limit int `yaml:"limit,omitempty"`
+
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is an alerting or recording rule of a RuleGroup.
+type Rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	For         model.Duration    `yaml:"for,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// RuleGroupFromRulefmt converts the input rulefmt rule group, e.g. parsed
+// from a rules file, to a RuleGroup.
+func RuleGroupFromRulefmt(rg rulefmt.RuleGroup) RuleGroup {
+	result := RuleGroup{
+		Name:     rg.Name,
+		Interval: rg.Interval,
+		Rules:    make([]Rule, 0, len(rg.Rules)),
+	}
+
+	for _, r := range rg.Rules {
+		result.Rules = append(result.Rules, Rule{
+			Record:      r.Record.Value,
+			Alert:       r.Alert.Value,
+			Expr:        r.Expr.Value,
+			For:         r.For,
+			Labels:      r.Labels,
+			Annotations: r.Annotations,
+		})
+	}
+
+	return result
+}
+
+// Rulefmt converts the rule group to a rulefmt rule group, e.g. to be
+// validated with the ruler validation. The limit is dropped.
+func (rg RuleGroup) Rulefmt() rulefmt.RuleGroup {
+	result := rulefmt.RuleGroup{
+		Name:     rg.Name,
+		Interval: rg.Interval,
+		Rules:    make([]rulefmt.RuleNode, 0, len(rg.Rules)),
+	}
+
+	for _, r := range rg.Rules {
+		node := rulefmt.RuleNode{
+			For:         r.For,
+			Labels:      r.Labels,
+			Annotations: r.Annotations,
+		}
+		if r.Record != "" {
+			node.Record.SetString(r.Record)
+		}
+		if r.Alert != "" {
+			node.Alert.SetString(r.Alert)
+		}
+		node.Expr.SetString(r.Expr)
+
+		result.Rules = append(result.Rules, node)
+	}
+
+	return result
+}
+
+// RuleValidationError is returned by SetRuleGroup when the ruler rejects a rule
+// group because it's invalid.
+type RuleValidationError struct {
+	Namespace string
+	Group     string
+
+	// RuleIndex and RuleName identify the invalid rule. RuleIndex is -1 if the
+	// error isn't specific to a rule (e.g. too many rules in the group).
+	RuleIndex int
+	RuleName  string
+
+	// Message is the validation error of the rule, or the raw response body if
+	// the error isn't specific to a rule.
+	Message string
+}
+
+func (e *RuleValidationError) Error() string {
+	if e.RuleIndex < 0 {
+		return fmt.Sprintf("invalid rule group %q in namespace %q: %s", e.Group, e.Namespace, e.Message)
+	}
+	return fmt.Sprintf("invalid rule group %q in namespace %q: rule %d (%q): %s", e.Group, e.Namespace, e.RuleIndex, e.RuleName, e.Message)
+}
+
+// ruleErrorRegexp matches the rule validation errors returned by the ruler,
+// formatted by rulefmt.Error, optionally prefixed by the positions of the
+// invalid YAML nodes.
+var ruleErrorRegexp = regexp.MustCompile(`^(?:\d+:\d+: )*group ("(?:[^"\\]|\\.)*"), rule (\d+), ("(?:[^"\\]|\\.)*"): ((?s:.*))$`)
+
+// parseRuleValidationError parses the body of a response rejecting the input
+// rule group, falling back to the raw body if the error isn't specific to a rule.
+func parseRuleValidationError(namespace string, rg RuleGroup, body []byte) *RuleValidationError {
+	msg := strings.TrimSpace(string(body))
+	result := &RuleValidationError{Namespace: namespace, Group: rg.Name, RuleIndex: -1, Message: msg}
+
+	m := ruleErrorRegexp.FindStringSubmatch(msg)
+	if m == nil {
+		return result
+	}
+
+	group, groupErr := strconv.Unquote(m[1])
+	index, indexErr := strconv.Atoi(m[2])
+	name, nameErr := strconv.Unquote(m[3])
+	if groupErr != nil || indexErr != nil || nameErr != nil {
+		return result
+	}
+
+	result.Group = group
+	result.RuleIndex = index
+	result.RuleName = name
+	result.Message = m[4]
+	return result
+}
+
+// encodeRuleGroup returns the wire YAML of the input rule group.
+func encodeRuleGroup(rg RuleGroup) ([]byte, error) {
+	return yaml.Marshal(rg)
+}
+
+// decodeRuleGroup parses the wire YAML of a single rule group.
+func decodeRuleGroup(data []byte) (RuleGroup, error) {
+	rg := RuleGroup{}
+	if err := yaml.Unmarshal(data, &rg); err != nil {
+		return RuleGroup{}, err
+	}
+	return rg, nil
+}
+
+// decodeRuleGroups parses the wire YAML of the rule groups keyed by namespace.
+func decodeRuleGroups(data []byte) (map[string][]RuleGroup, error) {
+	rgs := map[string][]RuleGroup{}
+	if err := yaml.Unmarshal(data, &rgs); err != nil {
+		return nil, err
+	}
+	return rgs, nil
+}
+
+// SetRuleGroups uploads the input rule groups, keyed by namespace, using a pool
+// of concurrency workers. A failing upload doesn't abort the others: the
+// returned error is a tsdb_errors.MultiError including an error for each
+// namespace and group which failed, ordered by namespace. The context is
+// checked before each upload, and once it's done the groups not uploaded yet
+// fail with the context error.
+func (c *Client) SetRuleGroups(ctx context.Context, groups map[string][]RuleGroup, concurrency int) error {
+	if concurrency <= 0 {
+		return fmt.Errorf("invalid concurrency %d", concurrency)
+	}
+
+	type job struct {
+		namespace string
+		group     RuleGroup
+	}
+
+	namespaces := make([]string, 0, len(groups))
+	for namespace := range groups {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	var jobs []job
+	for _, namespace := range namespaces {
+		for _, rg := range groups[namespace] {
+			jobs = append(jobs, job{namespace: namespace, group: rg})
+		}
+	}
+
+	var (
+		wg   = sync.WaitGroup{}
+		ch   = make(chan int)
+		errs = make([]error, len(jobs))
+	)
+
+	for ix := 0; ix < concurrency; ix++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for i := range ch {
+				err := ctx.Err()
+				if err == nil {
+					err = c.SetRuleGroup(jobs[i].group, jobs[i].namespace)
+				}
+				if err != nil {
+					errs[i] = fmt.Errorf("setting rule group %q of namespace %q: %w", jobs[i].group.Name, jobs[i].namespace, err)
+				}
+			}
+		}()
+	}
+
+	for i := range jobs {
+		ch <- i
+	}
+	close(ch)
+	wg.Wait()
+
+	merr := tsdb_errors.MultiError{}
+	for _, err := range errs {
+		merr.Add(err)
+	}
+	return merr.Err()
+}
@@ -0,0 +1,228 @@
+package e2ecortex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/rulefmt"
+	tsdb_errors "github.com/prometheus/prometheus/tsdb/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v3"
+
+	"github.com/cortexproject/cortex/pkg/ruler"
+)
+
+func TestRuleGroup_RoundTrip(t *testing.T) {
+	expected := RuleGroup{
+		Name:     "group",
+		Interval: model.Duration(time.Minute),
+		Rules: []Rule{
+			{
+				Record: "job:requests:rate5m",
+				Expr:   "sum by (job) (\n  rate(requests_total[5m])\n)\n",
+				Labels: map[string]string{"team": "a"},
+			},
+			{
+				Alert:       "HighErrorRate",
+				Expr:        "job:errors:rate5m\n  / job:requests:rate5m > 0.1",
+				For:         model.Duration(90 * time.Second),
+				Labels:      map[string]string{"severity": "page"},
+				Annotations: map[string]string{"summary": "Taux d'erreur élevé 🔥", "description": "エラー率が高い: {{ $value }}"},
+			},
+		},
+	}
+
+	data, err := encodeRuleGroup(expected)
+	require.NoError(t, err)
+
+	actual, err := decodeRuleGroup(data)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	// The wire YAML should be accepted by the ruler.
+	rg := rulefmt.RuleGroup{}
+	require.NoError(t, yaml.Unmarshal(data, &rg))
+	assert.Empty(t, ruler.ValidateRuleGroup(rg))
+	assert.Equal(t, expected, RuleGroupFromRulefmt(rg))
+
+	data, err = yaml.Marshal(map[string][]RuleGroup{"namespace": {expected}})
+	require.NoError(t, err)
+
+	rgs, err := decodeRuleGroups(data)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]RuleGroup{"namespace": {expected}}, rgs)
+}
+
+func TestRuleGroup_IntervalAndLimit(t *testing.T) {
+	expected := RuleGroup{
+		Name:     "group",
+		Interval: model.Duration(5 * time.Second),
+		Limit:    10,
+		Rules:    []Rule{{Record: "rule", Expr: "up"}},
+	}
+
+	data, err := encodeRuleGroup(expected)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "interval: 5s\n")
+	assert.Contains(t, string(data), "limit: 10\n")
+
+	actual, err := decodeRuleGroup(data)
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	// The interval and limit should be omitted when not set.
+	data, err = encodeRuleGroup(RuleGroup{Name: "group", Rules: expected.Rules})
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "interval")
+	assert.NotContains(t, string(data), "limit")
+
+	// The interval is kept by the conversion to rulefmt, while the limit is dropped.
+	rg := expected.Rulefmt()
+	assert.Equal(t, model.Duration(5*time.Second), rg.Interval)
+
+	expected.Limit = 0
+	assert.Equal(t, expected, RuleGroupFromRulefmt(rg))
+}
+
+func TestRuleGroup_Rulefmt(t *testing.T) {
+	const rulesFile = `
+groups:
+- name: group
+  interval: 30s
+  rules:
+  # A comment which should be ignored.
+  - record: job:up:sum
+    expr: |
+      sum by (job) (
+        up
+      )
+  - alert: InstanceDown
+    expr: up == 0
+    for: 5m
+    annotations:
+      summary: "instance {{ $labels.instance }} is down"
+`
+
+	groups, errs := rulefmt.Parse([]byte(rulesFile))
+	require.Empty(t, errs)
+	require.Len(t, groups.Groups, 1)
+
+	rg := RuleGroupFromRulefmt(groups.Groups[0])
+	assert.Equal(t, RuleGroup{
+		Name:     "group",
+		Interval: model.Duration(30 * time.Second),
+		Rules: []Rule{
+			{Record: "job:up:sum", Expr: "sum by (job) (\n  up\n)\n"},
+			{Alert: "InstanceDown", Expr: "up == 0", For: model.Duration(5 * time.Minute), Annotations: map[string]string{"summary": "instance {{ $labels.instance }} is down"}},
+		},
+	}, rg)
+
+	converted := rg.Rulefmt()
+	assert.Empty(t, ruler.ValidateRuleGroup(converted))
+	assert.Equal(t, rg, RuleGroupFromRulefmt(converted))
+}
+
+func TestClient_SetRuleGroups(t *testing.T) {
+	var (
+		mtx      sync.Mutex
+		uploaded []string
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		rg, err := decodeRuleGroup(body)
+		require.NoError(t, err)
+
+		if rg.Name == "invalid" {
+			http.Error(w, "invalid rule group", http.StatusBadRequest)
+			return
+		}
+
+		mtx.Lock()
+		uploaded = append(uploaded, strings.TrimPrefix(r.URL.Path, "/api/prom/rules/")+"/"+rg.Name)
+		mtx.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	groups := map[string][]RuleGroup{}
+	var expected []string
+	for ns := 0; ns < 5; ns++ {
+		namespace := fmt.Sprintf("namespace-%d", ns)
+		for g := 0; g < 10; g++ {
+			groups[namespace] = append(groups[namespace], RuleGroup{Name: fmt.Sprintf("group-%d", g), Rules: []Rule{{Record: "rule", Expr: "up"}}})
+			expected = append(expected, fmt.Sprintf("%s/group-%d", namespace, g))
+		}
+	}
+
+	require.NoError(t, c.SetRuleGroups(context.Background(), groups, 4))
+	assert.ElementsMatch(t, expected, uploaded)
+
+	// Failing uploads should be reported, without aborting the others.
+	uploaded = nil
+	groups["namespace-0"] = append(groups["namespace-0"], RuleGroup{Name: "invalid"})
+	groups["namespace-3"] = append(groups["namespace-3"], RuleGroup{Name: "invalid"})
+
+	err := c.SetRuleGroups(context.Background(), groups, 4)
+	require.Error(t, err)
+	merr, ok := err.(tsdb_errors.MultiError)
+	require.True(t, ok)
+	require.Len(t, merr, 2)
+	assert.Contains(t, merr[0].Error(), `setting rule group "invalid" of namespace "namespace-0"`)
+	var validationErr *RuleValidationError
+	assert.True(t, errors.As(merr[0], &validationErr))
+	assert.Contains(t, merr[1].Error(), `setting rule group "invalid" of namespace "namespace-3"`)
+	assert.ElementsMatch(t, expected, uploaded)
+
+	// Groups should not be uploaded once the context is canceled.
+	uploaded = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err = c.SetRuleGroups(ctx, groups, 4)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err.(tsdb_errors.MultiError)[0], context.Canceled))
+	assert.Empty(t, uploaded)
+
+	require.Error(t, c.SetRuleGroups(context.Background(), groups, 0))
+}
+
+func TestParseRuleValidationError(t *testing.T) {
+	rg := RuleGroup{Name: "group"}
+
+	for _, tc := range []struct {
+		body     string
+		expected *RuleValidationError
+	}{
+		{
+			body:     "group \"group\", rule 0, \"rule_0\": could not parse expression: 1:7: parse error: unclosed left parenthesis\n",
+			expected: &RuleValidationError{Namespace: "ns", Group: "group", RuleIndex: 0, RuleName: "rule_0", Message: "could not parse expression: 1:7: parse error: unclosed left parenthesis"},
+		},
+		{
+			body:     `4:5: 6:7: group "my \"quoted\" group", rule 2, "": one of 'record' or 'alert' must be set`,
+			expected: &RuleValidationError{Namespace: "ns", Group: `my "quoted" group`, RuleIndex: 2, RuleName: "", Message: "one of 'record' or 'alert' must be set"},
+		},
+		{
+			body:     "unable to decoded rule group\n",
+			expected: &RuleValidationError{Namespace: "ns", Group: "group", RuleIndex: -1, Message: "unable to decoded rule group"},
+		},
+	} {
+		assert.Equal(t, tc.expected, parseRuleValidationError("ns", rg, []byte(tc.body)))
+	}
+
+	assert.Equal(t, `invalid rule group "group" in namespace "ns": rule 1 ("rule_1"): bad expression`, (&RuleValidationError{Namespace: "ns", Group: "group", RuleIndex: 1, RuleName: "rule_1", Message: "bad expression"}).Error())
+	assert.Equal(t, `invalid rule group "group" in namespace "ns": too many rules`, (&RuleValidationError{Namespace: "ns", Group: "group", RuleIndex: -1, Message: "too many rules"}).Error())
+}
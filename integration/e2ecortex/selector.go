@@ -0,0 +1,182 @@
+package e2ecortex
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+)
+
+// Selector builds a PromQL series selector, escaping the label values so that
+// the selector is always syntactically valid. Invalid metric names, label names
+// and regular expressions are reported by Err.
+type Selector struct {
+	metric   string
+	matchers []*labels.Matcher
+	err      error
+}
+
+// NewSelector returns a selector for the input metric name. The metric name
+// can be empty, in which case at least one matcher should be added.
+func NewSelector(metric string) *Selector {
+	s := &Selector{metric: metric}
+	if metric != "" && !model.IsValidMetricName(model.LabelValue(metric)) {
+		s.err = fmt.Errorf("invalid metric name %q", metric)
+	}
+	return s
+}
+
+// Eq adds a label="value" matcher.
+func (s *Selector) Eq(name, value string) *Selector {
+	return s.add(labels.MatchEqual, name, value)
+}
+
+// Neq adds a label!="value" matcher.
+func (s *Selector) Neq(name, value string) *Selector {
+	return s.add(labels.MatchNotEqual, name, value)
+}
+
+// Re adds a label=~"regexp" matcher.
+func (s *Selector) Re(name, regexp string) *Selector {
+	return s.add(labels.MatchRegexp, name, regexp)
+}
+
+// Nre adds a label!~"regexp" matcher.
+func (s *Selector) Nre(name, regexp string) *Selector {
+	return s.add(labels.MatchNotRegexp, name, regexp)
+}
+
+func (s *Selector) add(t labels.MatchType, name, value string) *Selector {
+	if s.err != nil {
+		return s
+	}
+
+	if !model.LabelName(name).IsValid() {
+		s.err = fmt.Errorf("invalid label name %q", name)
+		return s
+	}
+
+	if !utf8.ValidString(value) {
+		s.err = fmt.Errorf("invalid UTF-8 value for label %q", name)
+		return s
+	}
+
+	m, err := labels.NewMatcher(t, name, value)
+	if err != nil {
+		s.err = fmt.Errorf("invalid matcher for label %q: %v", name, err)
+		return s
+	}
+
+	s.matchers = append(s.matchers, m)
+	return s
+}
+
+// In adds a label=~"regexp" matcher matching exactly any of the input values.
+func (s *Selector) In(name string, values ...string) *Selector {
+	return s.add(labels.MatchRegexp, name, orRegexp(values))
+}
+
+// Err returns the first error encountered while building the selector.
+func (s *Selector) Err() error {
+	return s.err
+}
+
+// Matchers returns the label matchers of the selector, including the metric
+// name one, e.g. to be used with RemoteRead.
+func (s *Selector) Matchers() ([]*labels.Matcher, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	if s.metric == "" {
+		return s.matchers, nil
+	}
+	return append([]*labels.Matcher{labels.MustNewMatcher(labels.MatchEqual, model.MetricNameLabel, s.metric)}, s.matchers...), nil
+}
+
+// String returns the selector in the PromQL syntax. It should not be used if
+// Err returns an error.
+func (s *Selector) String() string {
+	matchers := make([]string, 0, len(s.matchers))
+	for _, m := range s.matchers {
+		matchers = append(matchers, m.Name+m.Type.String()+quoteLabelValue(m.Value))
+	}
+
+	if s.metric != "" && len(matchers) == 0 {
+		return s.metric
+	}
+	return s.metric + "{" + strings.Join(matchers, ",") + "}"
+}
+
+// quoteLabelValue returns the input value as a PromQL double-quoted string.
+func quoteLabelValue(value string) string {
+	return `"` + escapeLabelValue(value) + `"`
+}
+
+// escapeLabelValue escapes the input value to be embedded in a PromQL
+// double-quoted string. Unlike strconv.Quote, non-printable characters are left
+// as is, because the PromQL lexer fails to parse numeric escape sequences at
+// the end of a string.
+func escapeLabelValue(value string) string {
+	b := strings.Builder{}
+
+	for _, r := range value {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
+
+// EscapeRegexLabelValue returns a regular expression matching exactly the input
+// value, escaped to be embedded in a PromQL double-quoted string, e.g. in
+// fmt.Sprintf(`{job=~"%s"}`, EscapeRegexLabelValue(job)).
+func EscapeRegexLabelValue(v string) string {
+	return escapeLabelValue(regexp.QuoteMeta(v))
+}
+
+// OrValues returns a regular expression matching exactly any of the input
+// values, escaped to be embedded in a PromQL double-quoted string, e.g. in
+// fmt.Sprintf(`{job=~"%s"}`, OrValues(jobs...)). No values only matches the
+// empty value.
+func OrValues(vs ...string) string {
+	return escapeLabelValue(orRegexp(vs))
+}
+
+// orRegexp returns a regular expression matching exactly any of the input values.
+func orRegexp(vs []string) string {
+	quoted := make([]string, 0, len(vs))
+	for _, v := range vs {
+		quoted = append(quoted, regexp.QuoteMeta(v))
+	}
+	return strings.Join(quoted, "|")
+}
+
+// SelectorStrings returns the input selectors in the PromQL syntax, to be passed
+// to the methods accepting series matchers (e.g. Series). It returns the first
+// error encountered while building any of the selectors.
+func SelectorStrings(selectors ...*Selector) ([]string, error) {
+	result := make([]string, 0, len(selectors))
+	for _, s := range selectors {
+		if err := s.Err(); err != nil {
+			return nil, err
+		}
+		result = append(result, s.String())
+	}
+	return result, nil
+}
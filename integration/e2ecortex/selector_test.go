@@ -0,0 +1,183 @@
+package e2ecortex
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelector(t *testing.T) {
+	tests := map[string]struct {
+		selector    *Selector
+		expected    string
+		expectedErr bool
+	}{
+		"metric name only": {
+			selector: NewSelector("series_1"),
+			expected: "series_1",
+		},
+		"all matcher types": {
+			selector: NewSelector("series_1").Eq("job", "test").Neq("env", "prod").Re("pod", "app-.*").Nre("zone", "a|b"),
+			expected: `series_1{job="test",env!="prod",pod=~"app-.*",zone!~"a|b"}`,
+		},
+		"no metric name": {
+			selector: NewSelector("").Eq("__name__", "series_1"),
+			expected: `{__name__="series_1"}`,
+		},
+		"escaped values": {
+			selector: NewSelector("series_1").Eq("path", `C:\dir "quoted"`),
+			expected: `series_1{path="C:\\dir \"quoted\""}`,
+		},
+		"invalid metric name": {
+			selector:    NewSelector("series-1"),
+			expectedErr: true,
+		},
+		"invalid label name": {
+			selector:    NewSelector("series_1").Eq("0job", "test"),
+			expectedErr: true,
+		},
+		"invalid regexp": {
+			selector:    NewSelector("series_1").Re("job", "(test"),
+			expectedErr: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			if test.expectedErr {
+				require.Error(t, test.selector.Err())
+				_, err := SelectorStrings(test.selector)
+				require.Error(t, err)
+				return
+			}
+
+			require.NoError(t, test.selector.Err())
+			assert.Equal(t, test.expected, test.selector.String())
+
+			_, err := parser.ParseMetricSelector(test.selector.String())
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestSelector_RandomLabelValues(t *testing.T) {
+	alphabet := []rune("ab\\\"'`{}[]|.*+?()=~!,\n\t\x00 ÄΩ✓🙂")
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	// The server parses the matchers like Cortex does, rejecting invalid ones.
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, r.ParseForm())
+		received = r.Form["match[]"]
+
+		for _, m := range received {
+			if _, err := parser.ParseMetricSelector(m); err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"parse error"}`))
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"status":"success","data":[]}`))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "user-1")
+
+	for i := 0; i < 200; i++ {
+		value := make([]rune, rnd.Intn(20))
+		for j := range value {
+			value[j] = alphabet[rnd.Intn(len(alphabet))]
+		}
+
+		selector := NewSelector("series_1").Eq("value", string(value)).Neq("other", string(value))
+		require.NoError(t, selector.Err())
+
+		matches, err := SelectorStrings(selector)
+		require.NoError(t, err)
+
+		_, err = c.Series(matches, time.Now().Add(-time.Hour), time.Now())
+		require.NoError(t, err, "selector: %s", selector)
+		require.Equal(t, matches, received)
+
+		parsed, err := parser.ParseMetricSelector(received[0])
+		require.NoError(t, err)
+		assert.Equal(t, []*labels.Matcher{
+			labels.MustNewMatcher(labels.MatchEqual, "value", string(value)),
+			labels.MustNewMatcher(labels.MatchNotEqual, "other", string(value)),
+			labels.MustNewMatcher(labels.MatchEqual, "__name__", "series_1"),
+		}, parsed)
+	}
+}
+
+func TestEscapeRegexLabelValue(t *testing.T) {
+	tests := map[string]struct {
+		value    string
+		expected string
+	}{
+		"plain":        {value: "test", expected: `test`},
+		"pipe":         {value: "a|b", expected: `a\\|b`},
+		"dot":          {value: "app.v1", expected: `app\\.v1`},
+		"double quote": {value: `say "hi"`, expected: `say \"hi\"`},
+		"backslash":    {value: `C:\dir`, expected: `C:\\\\dir`},
+		"unicode":      {value: "Ωmega ✓", expected: `Ωmega ✓`},
+		"newline":      {value: "a\nb", expected: `a\nb`},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			escaped := EscapeRegexLabelValue(test.value)
+			assert.Equal(t, test.expected, escaped)
+
+			// The escaped value should match the literal value only.
+			matchers, err := parser.ParseMetricSelector(`{job=~"` + escaped + `"}`)
+			require.NoError(t, err)
+			require.Len(t, matchers, 1)
+			assert.True(t, matchers[0].Matches(test.value))
+			assert.False(t, matchers[0].Matches(test.value+"x"))
+			assert.False(t, matchers[0].Matches("x"+test.value))
+		})
+	}
+}
+
+func TestOrValues(t *testing.T) {
+	values := []string{"a|b", "app.v1", `say "hi"`, `C:\dir`, "Ωmega ✓"}
+
+	matchers, err := parser.ParseMetricSelector(`{job=~"` + OrValues(values...) + `"}`)
+	require.NoError(t, err)
+	require.Len(t, matchers, 1)
+
+	for _, v := range values {
+		assert.True(t, matchers[0].Matches(v), v)
+	}
+	for _, v := range []string{"a", "b", "appxv1", `C:dir`, "Ωmega", ""} {
+		assert.False(t, matchers[0].Matches(v), v)
+	}
+
+	// No values should only match the empty value.
+	matchers, err = parser.ParseMetricSelector(`{job=~"` + OrValues() + `"}`)
+	require.NoError(t, err)
+	assert.True(t, matchers[0].Matches(""))
+	assert.False(t, matchers[0].Matches("a"))
+
+	// The selector builder should escape the values the same way.
+	selector := NewSelector("series_1").In("job", values...)
+	require.NoError(t, selector.Err())
+
+	matchers, err = parser.ParseMetricSelector(selector.String())
+	require.NoError(t, err)
+	require.Len(t, matchers, 2)
+	for _, v := range values {
+		assert.True(t, matchers[0].Matches(v), v)
+	}
+	assert.False(t, matchers[0].Matches("a"))
+}
@@ -553,7 +553,7 @@ func TestQuerierWithChunksStorage(t *testing.T) {
 		require.NoError(t, err)
 
 		if userID == 0 { // No need to repeat this test for each user.
-			res, body, err := c.QueryRaw("{instance=~\"hello.*\"}")
+			res, body, err := c.QueryRaw("{instance=~\"hello.*\"}", now)
 			require.NoError(t, err)
 			require.Equal(t, 422, res.StatusCode)
 			require.Contains(t, string(body), "query must contain metric name")